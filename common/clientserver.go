@@ -26,11 +26,17 @@
 package common
 
 import (
+	"bufio"
 	"fmt"
 	"log"
+	"os"
 	"quake2srv/shared"
+	"strconv"
+	"strings"
 )
 
+const NUM_CON_LINES = 512 /* recent console lines kept per game */
+
 type AbortFrame struct{}
 
 func (m *AbortFrame) Error() string {
@@ -41,6 +47,186 @@ func (m *AbortFrame) Error() string {
  * Both client and server can use this, and it will
  * do the apropriate things.
  */
+func (T *qCommon) Com_Printf(format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+
+	if T.rd_flush != nil {
+		if (T.rd_buffer.Len() + len(msg)) > (T.rd_buffersize - 1) {
+			T.rd_flush(T.rd_buffer.String())
+			T.rd_buffer.Reset()
+		}
+
+		T.rd_buffer.WriteString(msg)
+		return
+	}
+
+	log.Print(msg)
+
+	T.console_mu.Lock()
+	defer T.console_mu.Unlock()
+
+	T.conAddText(msg)
+
+	/* logfile */
+	if (T.logfile_active != nil) && (T.logfile_active.Int() > 0) {
+		if T.logfile == nil {
+			T.openLogfile()
+		}
+
+		if T.logfile != nil {
+			T.logfile.WriteString(msg)
+
+			if T.logfile_active.Int() > 1 {
+				T.logfile.Flush() /* force it to save every time */
+			}
+		}
+	} else if T.logfile != nil {
+		T.closeLogfile()
+	}
+}
+
+/*
+ * Splits the printed text into lines for the
+ * console history. Incomplete lines are held
+ * back until their newline arrives.
+ */
+func (T *qCommon) conAddText(msg string) {
+	T.con_partial += msg
+
+	for {
+		i := strings.IndexByte(T.con_partial, '\n')
+		if i < 0 {
+			break
+		}
+
+		if T.con_lines == nil {
+			T.con_lines = make([]string, NUM_CON_LINES)
+		}
+
+		T.con_lines[T.con_current%NUM_CON_LINES] = T.con_partial[:i]
+		T.con_current++
+		T.con_partial = T.con_partial[i+1:]
+	}
+}
+
+/*
+ * Returns the most recent console lines of
+ * this game, oldest first. Safe to call from
+ * outside the game loop.
+ */
+func (T *qCommon) Com_ConsoleLines() []string {
+	T.console_mu.Lock()
+	defer T.console_mu.Unlock()
+
+	start := 0
+	if T.con_current > NUM_CON_LINES {
+		start = T.con_current - NUM_CON_LINES
+	}
+
+	lines := make([]string, 0, T.con_current-start)
+	for i := start; i < T.con_current; i++ {
+		lines = append(lines, T.con_lines[i%NUM_CON_LINES])
+	}
+
+	return lines
+}
+
+/*
+ * Prints the last lines of the console,
+ * e.g. to look back over rcon.
+ */
+func com_ConLines_f(args []string, arg interface{}) error {
+	T := arg.(*qCommon)
+
+	count := 20
+	if len(args) > 1 {
+		if n, err := strconv.Atoi(args[1]); err == nil && n > 0 {
+			count = n
+		}
+	}
+
+	lines := T.Com_ConsoleLines()
+	if count < len(lines) {
+		lines = lines[len(lines)-count:]
+	}
+
+	for _, l := range lines {
+		T.Com_Printf("%s\n", l)
+	}
+	return nil
+}
+
+/*
+ * Every game instance writes a log of its own. When
+ * the game has a savegame directory the log is put
+ * next to the logs of the other instances.
+ */
+func (T *qCommon) logfileName() string {
+	if savedir := T.Cvar_VariableString("sv_savedir"); len(savedir) > 0 {
+		return fmt.Sprintf("%s/logs/%s/qconsole.log", T.FS_Gamedir(), savedir)
+	}
+
+	return fmt.Sprintf("%s/qconsole.log", T.FS_Gamedir())
+}
+
+func (T *qCommon) openLogfile() {
+	name := T.logfileName()
+
+	if i := strings.LastIndexByte(name, '/'); i > 0 {
+		os.MkdirAll(name[:i], 0755)
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if T.logfile_active.Int() > 2 {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(name, flags, 0644)
+	if err != nil {
+		log.Printf("Couldn't open %s: %v\n", name, err)
+		T.logfile_active.String = "0"
+		return
+	}
+
+	T.logfile_fd = f
+	T.logfile = bufio.NewWriter(f)
+}
+
+func (T *qCommon) closeLogfile() {
+	if T.logfile != nil {
+		T.logfile.Flush()
+		T.logfile_fd.Close()
+		T.logfile = nil
+		T.logfile_fd = nil
+	}
+}
+
+/*
+ * Sends everything printed until Com_EndRedirect to
+ * flush instead of the console, in chunks of at most
+ * buffersize bytes. Used by rcon to return the output
+ * of a command to the requester.
+ */
+func (T *qCommon) Com_BeginRedirect(buffersize int, flush func(string)) {
+	if (buffersize <= 0) || (flush == nil) {
+		return
+	}
+
+	T.rd_buffersize = buffersize
+	T.rd_flush = flush
+	T.rd_buffer.Reset()
+}
+
+func (T *qCommon) Com_EndRedirect() {
+	if T.rd_flush != nil && T.rd_buffer.Len() > 0 {
+		T.rd_flush(T.rd_buffer.String())
+	}
+
+	T.rd_buffer.Reset()
+	T.rd_buffersize = 0
+	T.rd_flush = nil
+}
+
 func (T *qCommon) Com_Error(code int, format string, a ...interface{}) error {
 
 	if T.recursive {
@@ -56,7 +242,7 @@ func (T *qCommon) Com_Error(code int, format string, a ...interface{}) error {
 		T.recursive = false
 		return &AbortFrame{}
 	} else if code == shared.ERR_DROP {
-		log.Printf("********************\nERROR: %s\n********************\n", T.msg)
+		T.Com_Printf("********************\nERROR: %s\n********************\n", T.msg)
 		// SV_Shutdown(va("Server crashed: %s\n", msg), false)
 		// CL_Drop()
 		T.recursive = false
@@ -66,10 +252,9 @@ func (T *qCommon) Com_Error(code int, format string, a ...interface{}) error {
 		// CL_Shutdown()
 	}
 
-	// if logfile {
-	// 	fclose(logfile)
-	// 	logfile = NULL
-	// }
+	T.console_mu.Lock()
+	T.closeLogfile()
+	T.console_mu.Unlock()
 
 	log.Fatal(T.msg)
 	T.recursive = false
@@ -29,8 +29,8 @@ package common
 
 import (
 	"fmt"
-	"log"
 	"quake2srv/shared"
+	"sort"
 	"strings"
 )
 
@@ -53,14 +53,9 @@ func (T *qCommon) Cbuf_InsertText(text string) {
 
 func (T *qCommon) Cbuf_Execute() error {
 
-	// if T.cmd_wait > 0 {
-	// 	// make sure that "wait" in scripts waits for ~16.66ms (1 frame at 60fps)
-	// 	// regardless of framerate
-	// 	if T.Sys_Milliseconds()-T.cmd_wait <= 16 {
-	// 		return nil
-	// 	}
-	// 	T.cmd_wait = 0
-	// }
+	/* the remaining commands run
+	   one frame after a wait */
+	T.cmd_wait = false
 
 	T.alias_count = 0 /* don't allow infinite alias loops */
 
@@ -103,11 +98,11 @@ func (T *qCommon) Cbuf_Execute() error {
 			return err
 		}
 
-		// if T.cmd_wait > 0 {
-		// 	/* skip out while text still remains in buffer,
-		// 	   leaving it for after we're done waiting */
-		// 	break
-		// }
+		if T.cmd_wait {
+			/* skip out while text still remains in buffer,
+			   leaving it for after we're done waiting */
+			break
+		}
 	}
 	return nil
 }
@@ -248,7 +243,7 @@ func (T *qCommon) Cmd_ExecuteString(text string) error {
 	if ok {
 		T.alias_count++
 		if T.alias_count == aliasLoopCount {
-			log.Printf("ALIAS_LOOP_COUNT\n")
+			T.Com_Printf("ALIAS_LOOP_COUNT\n")
 			return nil
 		}
 
@@ -264,7 +259,7 @@ func (T *qCommon) Cmd_ExecuteString(text string) error {
 	/* send it as a server command if we are connected */
 	// Cmd_ForwardToServer()
 
-	fmt.Printf("Unknown command \"%v\"\n", args[0])
+	T.Com_Printf("Unknown command \"%v\"\n", args[0])
 	return nil
 }
 
@@ -277,10 +272,10 @@ func cmd_Alias_f(args []string, arg interface{}) error {
 	T := arg.(*qCommon)
 
 	if len(args) == 1 {
-		log.Printf("Current alias commands:\n")
+		T.Com_Printf("Current alias commands:\n")
 
 		for k, v := range T.cmd_alias {
-			log.Printf("%v : %v\n", k, v)
+			T.Com_Printf("%v : %v\n", k, v)
 		}
 
 		return nil
@@ -307,6 +302,88 @@ func cmd_Alias_f(args []string, arg interface{}) error {
 	return nil
 }
 
+func cmd_Unalias_f(args []string, arg interface{}) error {
+
+	T := arg.(*qCommon)
+
+	if len(args) != 2 {
+		T.Com_Printf("unalias <name> : delete an alias\n")
+		return nil
+	}
+
+	name := strings.ToLower(args[1])
+	if _, ok := T.cmd_alias[name]; !ok {
+		T.Com_Printf("%s is not an alias\n", args[1])
+		return nil
+	}
+
+	delete(T.cmd_alias, name)
+	return nil
+}
+
+/*
+ * Causes execution of the remainder of the command buffer to be delayed
+ * until next frame. This allows commands like: bind g "impulse 5 ;
+ * +attack ; wait ; -attack ; impulse 2"
+ */
+func cmd_Wait_f(args []string, arg interface{}) error {
+	T := arg.(*qCommon)
+	T.cmd_wait = true
+	return nil
+}
+
+/*
+ * Just prints the rest of the line to the console
+ */
+func cmd_Echo_f(args []string, arg interface{}) error {
+	T := arg.(*qCommon)
+	T.Com_Printf("%s\n", strings.Join(args[1:], " "))
+	return nil
+}
+
+/*
+ * Inserts the current value of a variable as command text
+ */
+func cmd_Vstr_f(args []string, arg interface{}) error {
+	T := arg.(*qCommon)
+
+	if len(args) != 2 {
+		T.Com_Printf("vstr <variablename> : execute a variable command\n")
+		return nil
+	}
+
+	T.Cbuf_InsertText(T.Cvar_VariableString(args[1]))
+	return nil
+}
+
+/*
+ * Lists all commands, or only those
+ * starting with the given prefix
+ */
+func cmd_List_f(args []string, arg interface{}) error {
+	T := arg.(*qCommon)
+
+	filter := ""
+	if len(args) > 1 {
+		filter = strings.ToLower(args[1])
+	}
+
+	names := make([]string, 0, len(T.cmd_functions))
+	for name := range T.cmd_functions {
+		if strings.HasPrefix(name, filter) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		T.Com_Printf("%s\n", name)
+	}
+
+	T.Com_Printf("%v commands\n", len(names))
+	return nil
+}
+
 /*
  * Execute a script file
  */
@@ -315,17 +392,17 @@ func cmd_Exec_f(args []string, arg interface{}) error {
 	T := arg.(*qCommon)
 
 	if len(args) != 2 {
-		log.Printf("exec <filename> : execute a script file\n")
+		T.Com_Printf("exec <filename> : execute a script file\n")
 		return nil
 	}
 
 	bfr, err := T.fs.LoadFile(args[1])
 	if bfr == nil {
-		log.Printf("couldn't exec %s\n", args[1])
+		T.Com_Printf("couldn't exec %s\n", args[1])
 		return err
 	}
 
-	log.Printf("execing %s.\n", args[1])
+	T.Com_Printf("execing %s.\n", args[1])
 
 	T.Cbuf_InsertText(string(bfr))
 
@@ -334,10 +411,11 @@ func cmd_Exec_f(args []string, arg interface{}) error {
 
 func (T *qCommon) cmdInit() {
 	/* register our commands */
-	// Cmd_AddCommand("cmdlist", Cmd_List_f)
+	T.Cmd_AddCommand("cmdlist", cmd_List_f, T)
 	T.Cmd_AddCommand("exec", cmd_Exec_f, T)
-	// Cmd_AddCommand("vstr", Cmd_Vstr_f)
-	// Cmd_AddCommand("echo", Cmd_Echo_f)
+	T.Cmd_AddCommand("vstr", cmd_Vstr_f, T)
+	T.Cmd_AddCommand("echo", cmd_Echo_f, T)
 	T.Cmd_AddCommand("alias", cmd_Alias_f, T)
-	// T.Cmd_AddCommand("wait", cmd_Wait_f, T)
+	T.Cmd_AddCommand("unalias", cmd_Unalias_f, T)
+	T.Cmd_AddCommand("wait", cmd_Wait_f, T)
 }
@@ -31,6 +31,7 @@ import (
 	"math"
 	"quake2srv/shared"
 	"strconv"
+	"strings"
 )
 
 type cnode_t struct {
@@ -172,6 +173,27 @@ func (T *qCommon) CMSetAreaPortalState(portalnum int, open bool) {
 	T.floodAreaConnections()
 }
 
+/*
+ * Returns the portal state so it
+ * can be written to a savegame.
+ */
+func (T *qCommon) CMWritePortalState() []bool {
+	portals := make([]bool, len(T.collision.portalopen))
+	copy(portals, T.collision.portalopen[:])
+	return portals
+}
+
+/*
+ * Restores the portal state from a
+ * savegame and refloods the areas.
+ */
+func (T *qCommon) CMReadPortalState(portals []bool) {
+	for i := range T.collision.portalopen {
+		T.collision.portalopen[i] = i < len(portals) && portals[i]
+	}
+	T.floodAreaConnections()
+}
+
 func (T *qCommon) CMAreasConnected(area1, area2 int) bool {
 	if T.collision.map_noareas.Bool() {
 		return true
@@ -1266,40 +1288,26 @@ func (T *qCommon) cmodLoadVisibility(l shared.Lump_t, name string, buf []byte) e
 }
 
 func (T *qCommon) cmodLoadEntityString(l shared.Lump_t, name string, buf []byte) error {
-	// if (sv_entfile->value) {
-	// 	char s[MAX_QPATH];
-	// 	char *buffer = NULL;
-	// 	int nameLen, bufLen;
-
-	// 	nameLen = strlen(name);
-	// 	strcpy(s, name);
-	// 	s[nameLen-3] = 'e';	s[nameLen-2] = 'n';	s[nameLen-1] = 't';
-	// 	bufLen = FS_LoadFile(s, (void **)&buffer);
-
-	// 	if (buffer != NULL && bufLen > 1)
-	// 	{
-	// 		if (bufLen + 1 > sizeof(map_entitystring))
-	// 		{
-	// 			Com_Printf("CMod_LoadEntityString: .ent file %s too large: %i > %lu.\n", s, bufLen, (unsigned long)sizeof(map_entitystring));
-	// 			FS_FreeFile(buffer);
-	// 		}
-	// 		else
-	// 		{
-	// 			Com_Printf ("CMod_LoadEntityString: .ent file %s loaded.\n", s);
-	// 			numentitychars = bufLen;
-	// 			memcpy(map_entitystring, buffer, bufLen);
-	// 			map_entitystring[bufLen] = 0; /* jit entity bug - null terminate the entity string! */
-	// 			FS_FreeFile(buffer);
-	// 			return;
-	// 		}
-	// 	}
-	// 	else if (bufLen != -1)
-	// 	{
-	// 		/* If the .ent file is too small, don't load. */
-	// 		Com_Printf("CMod_LoadEntityString: .ent file %s too small.\n", s);
-	// 		FS_FreeFile(buffer);
-	// 	}
-	// }
+	if T.Cvar_VariableBool("sv_entfile") {
+		s := strings.TrimSuffix(name, ".bsp") + ".ent"
+		buffer, err := T.LoadFile(s)
+		if err != nil {
+			return err
+		}
+
+		if len(buffer) > 1 {
+			if len(buffer)+1 > shared.MAX_MAP_ENTSTRING {
+				T.Com_Printf("CMod_LoadEntityString: .ent file %s too large: %v > %v.\n", s, len(buffer), shared.MAX_MAP_ENTSTRING)
+			} else {
+				T.Com_Printf("CMod_LoadEntityString: .ent file %s loaded.\n", s)
+				T.collision.map_entitystring = string(buffer)
+				return nil
+			}
+		} else if buffer != nil {
+			/* If the .ent file is too small, don't load. */
+			T.Com_Printf("CMod_LoadEntityString: .ent file %s too small.\n", s)
+		}
+	}
 
 	// numentitychars = l->filelen;
 	// if (l.filelen + 1 > sizeof(map_entitystring)) {
@@ -1473,6 +1481,27 @@ func (T *qCommon) CMEntityString() string {
 	return T.collision.map_entitystring
 }
 
+/*
+ * Returns the names of the textures used by
+ * the surfaces of the current map, each name
+ * only once.
+ */
+func (T *qCommon) CMTextures() []string {
+	var textures []string
+	seen := make(map[string]bool)
+
+	for i := 0; i < T.collision.numtexinfo; i++ {
+		name := T.collision.map_surfaces[i].Rname
+		if len(name) == 0 || seen[name] {
+			continue
+		}
+		seen[name] = true
+		textures = append(textures, name)
+	}
+
+	return textures
+}
+
 func (T *qCommon) cmDecompressVis(in, out []byte) {
 	// int c;
 	// byte *out_p;
@@ -1507,7 +1536,7 @@ func (T *qCommon) cmDecompressVis(in, out []byte) {
 
 		if out_i+int(c) > row {
 			c = byte(row - out_i)
-			log.Printf("warning: Vis decompression overrun\n")
+			T.Com_Printf("warning: Vis decompression overrun\n")
 		}
 
 		for c > 0 {
@@ -26,8 +26,11 @@
 package common
 
 import (
-	"log"
+	"fmt"
+	"os"
 	"quake2srv/shared"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -93,7 +96,7 @@ func (Q *qCommon) Cvar_Get(var_name, var_value string, flags int) *shared.CvarT
 
 	if (flags & (shared.CVAR_USERINFO | shared.CVAR_SERVERINFO)) != 0 {
 		if !infoValidate(var_name) {
-			log.Printf("invalid info cvar name\n")
+			Q.Com_Printf("invalid info cvar name\n")
 			return nil
 		}
 	}
@@ -118,17 +121,16 @@ func (Q *qCommon) Cvar_Get(var_name, var_value string, flags int) *shared.CvarT
 
 	if (flags & (shared.CVAR_USERINFO | shared.CVAR_SERVERINFO)) != 0 {
 		if !infoValidate(var_value) {
-			log.Printf("invalid info cvar value\n")
+			Q.Com_Printf("invalid info cvar value\n")
 			return nil
 		}
 	}
 
-	// // if $game is the default one ("baseq2"), then use "" instead because
-	// // other code assumes this behavior (e.g. FS_BuildGameSpecificSearchPath())
-	// if(strcmp(var_name, "game") == 0 && strcmp(var_value, BASEDIRNAME) == 0)
-	// {
-	// 	var_value = "";
-	// }
+	// if $game is the default one ("baseq2"), then use "" instead because
+	// other code assumes this behavior (e.g. FS_BuildGameSpecificSearchPath())
+	if (var_name == "game") && (var_value == shared.BASEDIRNAME) {
+		var_value = ""
+	}
 
 	v = &shared.CvarT{}
 	v.Name = string(var_name)
@@ -151,20 +153,20 @@ func (T *qCommon) Cvar_Set2(var_name, value string, force bool) *shared.CvarT {
 
 	if (v.Flags & (shared.CVAR_USERINFO | shared.CVAR_SERVERINFO)) != 0 {
 		if !infoValidate(value) {
-			log.Printf("invalid info cvar value\n")
+			T.Com_Printf("invalid info cvar value\n")
 			return v
 		}
 	}
 
 	// if $game is the default one ("baseq2"), then use "" instead because
 	// other code assumes this behavior (e.g. FS_BuildGameSpecificSearchPath())
-	// if(strcmp(var_name, "game") == 0 && strcmp(value, BASEDIRNAME) == 0) {
-	// 	value = "";
-	// }
+	if (var_name == "game") && (value == shared.BASEDIRNAME) {
+		value = ""
+	}
 
 	if !force {
 		if (v.Flags & shared.CVAR_NOSET) != 0 {
-			log.Printf("%s is write protected.\n", var_name)
+			T.Com_Printf("%s is write protected.\n", var_name)
 			return v
 		}
 
@@ -182,14 +184,14 @@ func (T *qCommon) Cvar_Set2(var_name, value string, force bool) *shared.CvarT {
 			}
 
 			if T.ServerState() != 0 {
-				log.Printf("%v will be changed for next game.\n", var_name)
+				T.Com_Printf("%v will be changed for next game.\n", var_name)
 				v.LatchedString = &value
 			} else {
 				v.String = string(value)
 
-				// if (!strcmp(var->name, "game")) {
-				// 	FS_BuildGameSpecificSearchPath(var->string);
-				// }
+				if v.Name == "game" {
+					T.fsBuildGameSpecificSearchPath(v.String)
+				}
 			}
 
 			return v
@@ -236,10 +238,9 @@ func (T *qCommon) Cvar_FullSet(var_name, value string, flags int) *shared.CvarT
 
 	// if $game is the default one ("baseq2"), then use "" instead because
 	// other code assumes this behavior (e.g. FS_BuildGameSpecificSearchPath())
-	// if(strcmp(var_name, "game") == 0 && strcmp(value, BASEDIRNAME) == 0)
-	// {
-	// 	value = "";
-	// }
+	if (var_name == "game") && (value == shared.BASEDIRNAME) {
+		value = ""
+	}
 
 	v.String = string(value)
 	v.Flags = flags
@@ -247,6 +248,39 @@ func (T *qCommon) Cvar_FullSet(var_name, value string, flags int) *shared.CvarT
 	return v
 }
 
+/*
+ * Any variables with latched values will now be updated
+ */
+func (T *qCommon) Cvar_GetLatchedVars() {
+	for _, v := range T.cvarVars {
+		if v.LatchedString == nil {
+			continue
+		}
+
+		v.String = *v.LatchedString
+		v.LatchedString = nil
+
+		if v.Name == "game" {
+			T.fsBuildGameSpecificSearchPath(v.String)
+		}
+	}
+}
+
+/*
+ * Returns all variables having any of the
+ * given flags, sorted by name.
+ */
+func (T *qCommon) Cvar_VariablesWithFlags(flags int) []*shared.CvarT {
+	var vars []*shared.CvarT
+	for _, v := range T.cvarVars {
+		if (v.Flags & flags) != 0 {
+			vars = append(vars, v)
+		}
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+	return vars
+}
+
 /*
  * Handles variable inspection and changing from the console
  */
@@ -260,7 +294,7 @@ func (T *qCommon) cvar_Command(args []string) bool {
 
 	/* perform a variable print or set */
 	if len(args) == 1 {
-		log.Printf("\"%s\" is \"%s\"\n", v.Name, v.String)
+		T.Com_Printf("\"%s\" is \"%s\"\n", v.Name, v.String)
 		return true
 	}
 
@@ -287,7 +321,7 @@ func cvar_Set_f(args []string, arg interface{}) error {
 	//  c = Cmd_Argc();
 
 	if (len(args) != 3) && (len(args) != 4) {
-		log.Printf("usage: set <variable> <value> [u / s]\n")
+		T.Com_Printf("usage: set <variable> <value> [u / s]\n")
 		return nil
 	}
 
@@ -310,7 +344,7 @@ func cvar_Set_f(args []string, arg interface{}) error {
 		} else if args[3] == "s" {
 			flags = shared.CVAR_SERVERINFO
 		} else {
-			log.Printf("flags can only be 'u' or 's'\n")
+			T.Com_Printf("flags can only be 'u' or 's'\n")
 			return nil
 		}
 
@@ -321,15 +355,320 @@ func cvar_Set_f(args []string, arg interface{}) error {
 	return nil
 }
 
+/*
+ * Sets a variable and adds the flag to it.
+ * Used by seta, sets and setu.
+ */
+func (T *qCommon) cvarSetWithFlag(args []string, flag int) {
+	if len(args) != 3 {
+		T.Com_Printf("usage: %s <variable> <value>\n", args[0])
+		return
+	}
+
+	v := T.Cvar_Set(args[1], args[2])
+	if v == nil {
+		return
+	}
+
+	v.Flags |= flag
+
+	if (flag & shared.CVAR_USERINFO) != 0 {
+		T.userinfoModified = true
+	}
+}
+
+func cvar_SetA_f(args []string, arg interface{}) error {
+	T := arg.(*qCommon)
+	T.cvarSetWithFlag(args, shared.CVAR_ARCHIVE)
+	return nil
+}
+
+func cvar_SetS_f(args []string, arg interface{}) error {
+	T := arg.(*qCommon)
+	T.cvarSetWithFlag(args, shared.CVAR_SERVERINFO)
+	return nil
+}
+
+func cvar_SetU_f(args []string, arg interface{}) error {
+	T := arg.(*qCommon)
+	T.cvarSetWithFlag(args, shared.CVAR_USERINFO)
+	return nil
+}
+
+/*
+ * Appends lines containing "set variable value" for
+ * all variables with the archive flag set
+ */
+func (T *qCommon) cvarWriteVariables(path string) error {
+	var b strings.Builder
+
+	b.WriteString("// generated by quake, do not modify\n")
+
+	for _, v := range T.Cvar_VariablesWithFlags(shared.CVAR_ARCHIVE) {
+		value := v.String
+		if v.LatchedString != nil {
+			value = *v.LatchedString
+		}
+
+		b.WriteString(fmt.Sprintf("set %s \"%s\"\n", v.Name, value))
+	}
+
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+/*
+ * Writes all archived cvars to config.cfg
+ * or the given file in the game directory
+ */
+func cvar_WriteConfig_f(args []string, arg interface{}) error {
+	T := arg.(*qCommon)
+
+	if len(args) > 2 {
+		T.Com_Printf("usage: writeconfig [filename]\n")
+		return nil
+	}
+
+	name := "config.cfg"
+	if len(args) == 2 {
+		name = args[1]
+		if !strings.HasSuffix(name, ".cfg") {
+			name += ".cfg"
+		}
+	}
+
+	if strings.Contains(name, "..") || strings.ContainsAny(name, "/\\:") {
+		T.Com_Printf("Bad filename %s.\n", name)
+		return nil
+	}
+
+	path := fmt.Sprintf("%s/%s", T.FS_Gamedir(), name)
+	if err := T.cvarWriteVariables(path); err != nil {
+		T.Com_Printf("Couldn't write %s.\n", path)
+		return nil
+	}
+
+	T.Com_Printf("Wrote %s.\n", path)
+	return nil
+}
+
+/*
+ * Lists all cvars. The first argument may be a list of
+ * flags (e.g. "-as" for archived or serverinfo cvars),
+ * the second a name prefix.
+ */
+func cvar_List_f(args []string, arg interface{}) error {
+	T := arg.(*qCommon)
+
+	flags := 0
+	filter := ""
+
+	for _, a := range args[1:] {
+		if !strings.HasPrefix(a, "-") {
+			filter = a
+			continue
+		}
+
+		for _, c := range a[1:] {
+			switch c {
+			case 'a':
+				flags |= shared.CVAR_ARCHIVE
+			case 'u':
+				flags |= shared.CVAR_USERINFO
+			case 's':
+				flags |= shared.CVAR_SERVERINFO
+			case 'n':
+				flags |= shared.CVAR_NOSET
+			case 'l':
+				flags |= shared.CVAR_LATCH
+			default:
+				T.Com_Printf("usage: cvarlist [-ausnl] [prefix]\n")
+				return nil
+			}
+		}
+	}
+
+	names := make([]string, 0, len(T.cvarVars))
+	for name, v := range T.cvarVars {
+		if (flags != 0) && ((v.Flags & flags) == 0) {
+			continue
+		}
+
+		if !strings.HasPrefix(name, filter) {
+			continue
+		}
+
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		v := T.cvarVars[name]
+
+		var line strings.Builder
+
+		if (v.Flags & shared.CVAR_ARCHIVE) != 0 {
+			line.WriteByte('*')
+		} else {
+			line.WriteByte(' ')
+		}
+
+		if (v.Flags & shared.CVAR_USERINFO) != 0 {
+			line.WriteByte('U')
+		} else {
+			line.WriteByte(' ')
+		}
+
+		if (v.Flags & shared.CVAR_SERVERINFO) != 0 {
+			line.WriteByte('S')
+		} else {
+			line.WriteByte(' ')
+		}
+
+		if (v.Flags & shared.CVAR_NOSET) != 0 {
+			line.WriteByte('-')
+		} else if (v.Flags & shared.CVAR_LATCH) != 0 {
+			line.WriteByte('L')
+		} else {
+			line.WriteByte(' ')
+		}
+
+		T.Com_Printf("%s %s \"%s\"\n", line.String(), v.Name, v.String)
+	}
+
+	T.Com_Printf("%v cvars\n", len(names))
+	return nil
+}
+
+/*
+ * Toggles a cvar between 0 and 1, or
+ * cycles it through the given values
+ */
+func cvar_Toggle_f(args []string, arg interface{}) error {
+	T := arg.(*qCommon)
+
+	if len(args) < 2 {
+		T.Com_Printf("Usage: %s <var> [value] [...]\n", args[0])
+		return nil
+	}
+
+	v := T.cvarFindVar(args[1])
+	if v == nil {
+		T.Com_Printf("%s is not a variable\n", args[1])
+		return nil
+	}
+
+	if len(args) < 3 {
+		if v.String == "0" {
+			T.Cvar_Set(v.Name, "1")
+		} else if v.String == "1" {
+			T.Cvar_Set(v.Name, "0")
+		} else {
+			T.Com_Printf("\"%s\" is \"%s\", can't toggle\n", v.Name, v.String)
+		}
+
+		return nil
+	}
+
+	values := args[2:]
+	for i := range values {
+		if strings.EqualFold(v.String, values[i]) {
+			T.Cvar_Set(v.Name, values[(i+1)%len(values)])
+			return nil
+		}
+	}
+
+	T.Com_Printf("\"%s\" is \"%s\", can't cycle\n", v.Name, v.String)
+	return nil
+}
+
+/*
+ * Increments or decrements a cvar by
+ * one or by the given value
+ */
+func cvar_Inc_f(args []string, arg interface{}) error {
+	T := arg.(*qCommon)
+
+	if (len(args) != 2) && (len(args) != 3) {
+		T.Com_Printf("Usage: %s <var> [value]\n", args[0])
+		return nil
+	}
+
+	v := T.cvarFindVar(args[1])
+	if v == nil {
+		T.Com_Printf("%s is not a variable\n", args[1])
+		return nil
+	}
+
+	step := float32(1)
+	if len(args) == 3 {
+		s, err := strconv.ParseFloat(args[2], 32)
+		if err != nil {
+			T.Com_Printf("%s is not a number\n", args[2])
+			return nil
+		}
+		step = float32(s)
+	}
+
+	if strings.EqualFold(args[0], "dec") {
+		step = -step
+	}
+
+	T.Cvar_Set(v.Name, strconv.FormatFloat(float64(v.Float()+step), 'f', -1, 32))
+	return nil
+}
+
+/*
+ * Resets a cvar to its default value
+ */
+func cvar_Reset_f(args []string, arg interface{}) error {
+	T := arg.(*qCommon)
+
+	if len(args) != 2 {
+		T.Com_Printf("usage: reset <variable>\n")
+		return nil
+	}
+
+	v := T.cvarFindVar(args[1])
+	if v == nil {
+		T.Com_Printf("%s is not a variable\n", args[1])
+		return nil
+	}
+
+	T.Cvar_Set(v.Name, v.DefaultString)
+	return nil
+}
+
+/*
+ * Resets all cvars that are not write
+ * protected to their default values
+ */
+func cvar_ResetAll_f(args []string, arg interface{}) error {
+	T := arg.(*qCommon)
+
+	for _, v := range T.cvarVars {
+		if ((v.Flags & shared.CVAR_NOSET) != 0) || (v.Name == "game") {
+			continue
+		}
+
+		T.Cvar_Set(v.Name, v.DefaultString)
+	}
+
+	return nil
+}
+
 /*
  * Reads in all archived cvars
  */
 func (T *qCommon) cvar_Init() {
-	//  Cmd_AddCommand("cvarlist", Cvar_List_f);
-	//  Cmd_AddCommand("dec", Cvar_Inc_f);
-	//  Cmd_AddCommand("inc", Cvar_Inc_f);
-	//  Cmd_AddCommand("reset", Cvar_Reset_f);
-	//  Cmd_AddCommand("resetall", Cvar_ResetAll_f);
+	T.Cmd_AddCommand("cvarlist", cvar_List_f, T)
+	T.Cmd_AddCommand("dec", cvar_Inc_f, T)
+	T.Cmd_AddCommand("inc", cvar_Inc_f, T)
+	T.Cmd_AddCommand("reset", cvar_Reset_f, T)
+	T.Cmd_AddCommand("resetall", cvar_ResetAll_f, T)
 	T.Cmd_AddCommand("set", cvar_Set_f, T)
-	//  Cmd_AddCommand("toggle", Cvar_Toggle_f);
+	T.Cmd_AddCommand("seta", cvar_SetA_f, T)
+	T.Cmd_AddCommand("sets", cvar_SetS_f, T)
+	T.Cmd_AddCommand("setu", cvar_SetU_f, T)
+	T.Cmd_AddCommand("toggle", cvar_Toggle_f, T)
+	T.Cmd_AddCommand("writeconfig", cvar_WriteConfig_f, T)
 }
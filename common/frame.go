@@ -27,6 +27,7 @@ package common
 
 import (
 	"log"
+	"quake2srv/shared"
 	"time"
 )
 
@@ -88,23 +89,10 @@ func (Q *qCommon) Init(args []string) error {
 		return err
 	}
 
-	// 	// remember the initial game name that might have been set on commandline
-	// 	{
-	// 		cvar_t* gameCvar = Cvar_Get("game", "", CVAR_LATCH | CVAR_SERVERINFO);
-	// 		const char* game = "";
-
-	// 		if(gameCvar->string && gameCvar->string[0])
-	// 		{
-	// 			game = gameCvar->string;
-	// 		}
-
-	// 		Q_strlcpy(userGivenGame, game, sizeof(userGivenGame));
-	// 	}
-
 	// The filesystems needs to be initialized after the cvars.
-	// if err := Q.initFilesystem(); err != nil {
-	// 	return err
-	// }
+	// A mod given on the commandline is stacked above baseq2.
+	gameCvar := Q.Cvar_Get("game", "", shared.CVAR_LATCH|shared.CVAR_SERVERINFO)
+	Q.fsBuildGameSpecificSearchPath(gameCvar.String)
 
 	// Add and execute configuration files.
 	if err := Q.execConfigs(true); err != nil {
@@ -121,7 +109,8 @@ func (Q *qCommon) Init(args []string) error {
 	// 	developer = Cvar_Get("developer", "0", 0);
 	// 	fixedtime = Cvar_Get("fixedtime", "0", 0);
 
-	// 	logfile_active = Cvar_Get("logfile", "1", CVAR_ARCHIVE);
+	Q.logfile_active = Q.Cvar_Get("logfile", "1", shared.CVAR_ARCHIVE)
+	Q.Cmd_AddCommand("conlines", com_ConLines_f, Q)
 	// 	modder = Cvar_Get("modder", "0", 0);
 	// 	timescale = Cvar_Get("timescale", "1", 0);
 
@@ -149,8 +138,8 @@ func (Q *qCommon) Init(args []string) error {
 		}
 	}
 
-	log.Printf("==== Yamagi Quake II Initialized ====\n\n")
-	log.Printf("*************************************\n\n")
+	Q.Com_Printf("==== Yamagi Quake II Initialized ====\n\n")
+	Q.Com_Printf("*************************************\n\n")
 
 	// Call the main loop
 	// 	Qcommon_Mainloop();
@@ -299,4 +288,8 @@ func (T *qCommon) Curtime() int {
 
 func (T *qCommon) Quit() {
 	T.running = false
+
+	T.console_mu.Lock()
+	T.closeLogfile()
+	T.console_mu.Unlock()
 }
@@ -26,7 +26,11 @@
 package common
 
 import (
+	"bufio"
+	"os"
 	"quake2srv/shared"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -61,12 +65,26 @@ type qCommon struct {
 	recursive bool
 	msg       string
 
+	rd_buffer     strings.Builder /* redirected console output */
+	rd_buffersize int
+	rd_flush      func(string)
+
+	console_mu     sync.Mutex
+	con_lines      []string /* ring buffer of recent console lines */
+	con_current    int      /* number of lines printed so far */
+	con_partial    string
+	logfile_active *shared.CvarT
+	logfile        *bufio.Writer
+	logfile_fd     *os.File
+
 	cvarVars         map[string]*shared.CvarT
 	userinfoModified bool
 
-	fs shared.QFileSystem
+	fs      shared.QFileSystem /* search path of the current game */
+	fs_base shared.QFileSystem /* baseq2 search path */
 
 	cmd_text      string
+	cmd_wait      bool
 	alias_count   int
 	cmd_functions map[string]xcommand_t
 	cmd_alias     map[string]string
@@ -92,9 +110,53 @@ func (Q *qCommon) LoadFile(path string) ([]byte, error) {
 	return Q.fs.LoadFile(path)
 }
 
+func (Q *qCommon) FS_ListFiles(pattern string) []string {
+	list, _ := Q.fs.ListFiles(pattern)
+	return list
+}
+
+func (Q *qCommon) FS_ListMaps() []string {
+	return shared.ListMaps(Q.fs)
+}
+
+func (Q *qCommon) FS_FileExists(path string) bool {
+	info, err := Q.fs.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+func (Q *qCommon) FS_Gamedir() string {
+	return Q.fs.Gamedir()
+}
+
+func (Q *qCommon) FS_FileFromProtectedPak(path string) bool {
+	return Q.fs.FileFromProtectedPak(path)
+}
+
+/*
+ * Switches this game instance to the search path of
+ * a mod. Other games running in the process keep
+ * their own search path.
+ */
+func (Q *qCommon) fsBuildGameSpecificSearchPath(dir string) {
+	fs, err := Q.fs_base.GameFilesystem(dir)
+	if err != nil {
+		Q.Com_Printf("%v, using %v.\n", err, shared.BASEDIRNAME)
+		fs = Q.fs_base
+		dir = ""
+	}
+
+	Q.fs = fs
+	Q.Cvar_FullSet("gamedir", dir, shared.CVAR_SERVERINFO|shared.CVAR_NOSET)
+
+	Q.console_mu.Lock()
+	Q.closeLogfile() /* reopened in the new game directory */
+	Q.console_mu.Unlock()
+}
+
 func CreateQuekeCommon(fs shared.QFileSystem) shared.QCommon {
 	q := &qCommon{}
 	q.fs = fs
+	q.fs_base = fs
 	q.servertimedelta = 0
 	q.packetdelta = 1000000
 	q.net_clients = make(map[string]qNetClient)
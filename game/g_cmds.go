@@ -50,22 +50,21 @@ func (G *qGame) cmd_Use_f(ent *edict_t, args []string) {
 	println("USE:", len(args), args[1])
 
 	if it == nil {
-		// G.gi.Cprintf(ent, PRINT_HIGH, "unknown item: %s\n", s)
+		G.gi.Cprintf(ent, shared.PRINT_HIGH, "unknown item: %s\n", s)
 		return
 	}
 
 	if it.use == nil {
-		// 	 G.gi.Cprintf(ent, PRINT_HIGH, "Item is not usable.\n");
+		G.gi.Cprintf(ent, shared.PRINT_HIGH, "Item is not usable.\n")
 		return
 	}
 
-	//  index = ITEM_INDEX(it);
+	index := it.index
 
-	//  if (!ent->client->pers.inventory[index])
-	//  {
-	// 	 gi.cprintf(ent, PRINT_HIGH, "Out of item: %s\n", s);
-	// 	 return;
-	//  }
+	if ent.client.pers.inventory[index] == 0 {
+		G.gi.Cprintf(ent, shared.PRINT_HIGH, "Out of item: %s\n", s)
+		return
+	}
 
 	it.use(ent, it, G)
 }
@@ -98,11 +97,10 @@ func (G *qGame) ClientCommand(sent shared.Edict_s, args []string) {
 	// 	return;
 	// }
 
-	// if (Q_stricmp(cmd, "score") == 0)
-	// {
-	// 	Cmd_Score_f(ent);
-	// 	return;
-	// }
+	if args[0] == "score" {
+		G.cmd_Score_f(ent)
+		return
+	}
 
 	// if (Q_stricmp(cmd, "help") == 0)
 	// {
@@ -413,12 +413,12 @@ func door_hit_top(self *edict_t, G *qGame) {
 	}
 
 	if (self.flags & FL_TEAMSLAVE) == 0 {
-		//  if (self->moveinfo.sound_end) {
-		// 	 gi.sound(self, CHAN_NO_PHS_ADD + CHAN_VOICE, self->moveinfo.sound_end,
-		// 			 1, ATTN_STATIC, 0);
-		//  }
+		if self.moveinfo.sound_end != 0 {
+			G.gi.Sound(self, shared.CHAN_NO_PHS_ADD+shared.CHAN_VOICE, self.moveinfo.sound_end,
+				1, shared.ATTN_STATIC, 0)
+		}
 
-		//  self->s.sound = 0;
+		self.s.Sound = 0
 	}
 
 	self.moveinfo.state = STATE_TOP
@@ -439,13 +439,13 @@ func door_hit_bottom(self *edict_t, G *qGame) {
 	}
 
 	if (self.flags & FL_TEAMSLAVE) == 0 {
-		//  if (self->moveinfo.sound_end) {
-		// 	 gi.sound(self, CHAN_NO_PHS_ADD + CHAN_VOICE,
-		// 			 self->moveinfo.sound_end, 1,
-		// 			 ATTN_STATIC, 0);
-		//  }
+		if self.moveinfo.sound_end != 0 {
+			G.gi.Sound(self, shared.CHAN_NO_PHS_ADD+shared.CHAN_VOICE,
+				self.moveinfo.sound_end, 1,
+				shared.ATTN_STATIC, 0)
+		}
 
-		//  self->s.sound = 0;
+		self.s.Sound = 0
 	}
 
 	self.moveinfo.state = STATE_BOTTOM
@@ -458,13 +458,13 @@ func door_go_down(self *edict_t, G *qGame) {
 	}
 
 	if (self.flags & FL_TEAMSLAVE) == 0 {
-		// if (self->moveinfo.sound_start) {
-		// 	gi.sound(self, CHAN_NO_PHS_ADD + CHAN_VOICE,
-		// 			self->moveinfo.sound_start, 1,
-		// 			ATTN_STATIC, 0);
-		// }
+		if self.moveinfo.sound_start != 0 {
+			G.gi.Sound(self, shared.CHAN_NO_PHS_ADD+shared.CHAN_VOICE,
+				self.moveinfo.sound_start, 1,
+				shared.ATTN_STATIC, 0)
+		}
 
-		// self->s.sound = self->moveinfo.sound_middle;
+		self.s.Sound = self.moveinfo.sound_middle
 	}
 
 	if self.max_health != 0 {
@@ -500,13 +500,13 @@ func (G *qGame) door_go_up(self, activator *edict_t) {
 	}
 
 	if (self.flags & FL_TEAMSLAVE) == 0 {
-		// if (self->moveinfo.sound_start) {
-		// 	gi.sound(self, CHAN_NO_PHS_ADD + CHAN_VOICE,
-		// 			self->moveinfo.sound_start, 1,
-		// 			ATTN_STATIC, 0);
-		// }
+		if self.moveinfo.sound_start != 0 {
+			G.gi.Sound(self, shared.CHAN_NO_PHS_ADD+shared.CHAN_VOICE,
+				self.moveinfo.sound_start, 1,
+				shared.ATTN_STATIC, 0)
+		}
 
-		// self->s.sound = self->moveinfo.sound_middle;
+		self.s.Sound = self.moveinfo.sound_middle
 	}
 
 	self.moveinfo.state = STATE_UP
@@ -705,12 +705,11 @@ func spFuncDoor(ent *edict_t, G *qGame) error {
 		return nil
 	}
 
-	// if (ent.sounds != 1)
-	// {
-	// 	ent->moveinfo.sound_start = gi.soundindex("doors/dr1_strt.wav");
-	// 	ent->moveinfo.sound_middle = gi.soundindex("doors/dr1_mid.wav");
-	// 	ent->moveinfo.sound_end = gi.soundindex("doors/dr1_end.wav");
-	// }
+	if ent.Sounds != 1 {
+		ent.moveinfo.sound_start = G.gi.Soundindex("doors/dr1_strt.wav")
+		ent.moveinfo.sound_middle = G.gi.Soundindex("doors/dr1_mid.wav")
+		ent.moveinfo.sound_end = G.gi.Soundindex("doors/dr1_end.wav")
+	}
 
 	gSetMovedir(ent.s.Angles[:], ent.movedir[:])
 	ent.movetype = MOVETYPE_PUSH
@@ -135,32 +135,26 @@ func touch_Item(ent, other *edict_t, plane /* unused */ *shared.Cplane_t, surf /
 			other.client.pers.selected_item = int(other.client.ps.Stats[shared.STAT_SELECTED_ITEM])
 		}
 
-		// if (ent->item->pickup == Pickup_Health) {
-		// 	if (ent->count == 2) {
-		// 		gi.sound(other, CHAN_ITEM, gi.soundindex(
-		// 						"items/s_health.wav"), 1, ATTN_NORM, 0);
-		// 	}
-		// 	else if (ent->count == 10)
-		// 	{
-		// 		gi.sound(other, CHAN_ITEM, gi.soundindex(
-		// 						"items/n_health.wav"), 1, ATTN_NORM, 0);
-		// 	}
-		// 	else if (ent->count == 25)
-		// 	{
-		// 		gi.sound(other, CHAN_ITEM, gi.soundindex(
-		// 						"items/l_health.wav"), 1, ATTN_NORM, 0);
-		// 	}
-		// 	else /* (ent->count == 100) */
-		// 	{
-		// 		gi.sound(other, CHAN_ITEM, gi.soundindex(
-		// 						"items/m_health.wav"), 1, ATTN_NORM, 0);
-		// 	}
-		// }
-		// else if (ent->item->pickup_sound)
-		// {
-		// 	gi.sound(other, CHAN_ITEM, gi.soundindex(
-		// 					ent->item->pickup_sound), 1, ATTN_NORM, 0);
-		// }
+		/* functions can't be compared, all
+		   health items share the same gitem */
+		if ent.item.pickup_name == "Health" {
+			if ent.count == 2 {
+				G.gi.Sound(other, shared.CHAN_ITEM, G.gi.Soundindex(
+					"items/s_health.wav"), 1, shared.ATTN_NORM, 0)
+			} else if ent.count == 10 {
+				G.gi.Sound(other, shared.CHAN_ITEM, G.gi.Soundindex(
+					"items/n_health.wav"), 1, shared.ATTN_NORM, 0)
+			} else if ent.count == 25 {
+				G.gi.Sound(other, shared.CHAN_ITEM, G.gi.Soundindex(
+					"items/l_health.wav"), 1, shared.ATTN_NORM, 0)
+			} else { /* (ent->count == 100) */
+				G.gi.Sound(other, shared.CHAN_ITEM, G.gi.Soundindex(
+					"items/m_health.wav"), 1, shared.ATTN_NORM, 0)
+			}
+		} else if len(ent.item.pickup_sound) > 0 {
+			G.gi.Sound(other, shared.CHAN_ITEM, G.gi.Soundindex(
+				ent.item.pickup_sound), 1, shared.ATTN_NORM, 0)
+		}
 
 		/* activate item instantly if appropriate */
 		/* moved down here so activation sounds override the pickup sound */
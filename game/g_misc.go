@@ -290,7 +290,7 @@ func misc_deadsoldier_die(self, inflictor, attacker *edict_t, damage int, point
 		return
 	}
 
-	//  gi.sound(self, CHAN_BODY, gi.soundindex("misc/udeath.wav"), 1, ATTN_NORM, 0);
+	G.gi.Sound(self, shared.CHAN_BODY, G.gi.Soundindex("misc/udeath.wav"), 1, shared.ATTN_NORM, 0)
 
 	//  for (n = 0; n < 4; n++) {
 	// 	 ThrowGib(self,
@@ -770,7 +770,6 @@ func (G *qGame) svPhysics_Toss(ent *edict_t) {
 	//  edict_t *slave;
 	//  qboolean wasinwater;
 	//  qboolean isinwater;
-	//  vec3_t old_origin;
 
 	if ent == nil {
 		return
@@ -801,7 +800,8 @@ func (G *qGame) svPhysics_Toss(ent *edict_t) {
 		return
 	}
 
-	//  VectorCopy(ent->s.origin, old_origin);
+	old_origin := make([]float32, 3)
+	copy(old_origin, ent.s.Origin[:])
 
 	G.svCheckVelocity(ent)
 
@@ -854,11 +854,11 @@ func (G *qGame) svPhysics_Toss(ent *edict_t) {
 	}
 
 	if !wasinwater && isinwater {
-		// 	 gi.positioned_sound(old_origin, g_edicts, CHAN_AUTO,
-		// 			 gi.soundindex("misc/h2ohit1.wav"), 1, 1, 0);
+		G.gi.Positioned_sound(old_origin, &G.g_edicts[0], shared.CHAN_AUTO,
+			G.gi.Soundindex("misc/h2ohit1.wav"), 1, 1, 0)
 	} else if wasinwater && !isinwater {
-		// 	 gi.positioned_sound(ent->s.origin, g_edicts, CHAN_AUTO,
-		// 			 gi.soundindex("misc/h2ohit1.wav"), 1, 1, 0);
+		G.gi.Positioned_sound(ent.s.Origin[:], &G.g_edicts[0], shared.CHAN_AUTO,
+			G.gi.Soundindex("misc/h2ohit1.wav"), 1, 1, 0)
 	}
 
 	/* move teamslaves */
@@ -98,6 +98,22 @@ func (G *qGame) edCallSpawn(ent *edict_t) error {
 	return nil
 }
 
+/*
+ * Returns true if entities of the class can
+ * be spawned, either as item or through the
+ * spawn functions. Used to check maps.
+ */
+func HasSpawnFunction(classname string) bool {
+	for _, item := range gameitemlist {
+		if len(item.classname) > 0 && item.classname == classname {
+			return true
+		}
+	}
+
+	_, ok := spawns[classname]
+	return ok
+}
+
 /*
  * Takes a key/value pair and sets
  * the binary values in an edict
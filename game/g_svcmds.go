@@ -0,0 +1,349 @@
+/*
+ * Copyright (C) 1997-2001 Id Software, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *
+ * See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place - Suite 330, Boston, MA
+ * 02111-1307, USA.
+ *
+ * =======================================================================
+ *
+ * Game side of server CMDs. At this time only the ipfilter.
+ *
+ * =======================================================================
+ */
+package game
+
+import (
+	"fmt"
+	"os"
+	"quake2srv/shared"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+ * PACKET FILTERING
+ *
+ * You can add or remove addresses from the filter list with:
+ *
+ * addip <ip>
+ * removeip <ip>
+ *
+ * The ip address is specified in dot format, and any unspecified
+ * digits will match any value, so you can specify an entire class
+ * C network with "addip 192.246.40".
+ *
+ * Removeip will only remove an address specified exactly the same
+ * way.  You cannot addip a subnet, then removeip a single host.
+ *
+ * listip
+ * Prints the current list of filters.
+ *
+ * writeip
+ * Dumps "addip <ip>" commands to listip.cfg in the game directory.
+ * The file is read back when the first game starts.
+ *
+ * filterban <0 or 1>
+ * If 1 (the default), then ip addresses matching the current list
+ * will be prohibited from entering the game.  This is the default
+ * setting. If 0, then only addresses matching the list will be
+ * allowed.  This lets you easily set up a private game, or a
+ * game that only allows players from your local network.
+ *
+ * All games running in this process share one filter list and
+ * one filterban setting, so a ban applies to every game and to
+ * the queue of the manager.
+ */
+
+type ipfilter_t struct {
+	mask    uint32
+	compare uint32
+}
+
+const MAX_IPFILTERS = 1024
+
+var ipfilters []ipfilter_t
+var ipfilterban = true /* the filterban setting of all games */
+var ipfilters_mu sync.Mutex
+var ipfilters_loaded sync.Once
+
+func stringToFilter(s string) (ipfilter_t, bool) {
+	var b, m [4]byte
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 4 {
+		return ipfilter_t{}, false
+	}
+
+	for i, p := range parts {
+		if len(p) == 0 {
+			break
+		}
+
+		v, err := strconv.ParseUint(p, 10, 8)
+		if err != nil {
+			return ipfilter_t{}, false
+		}
+
+		b[i] = byte(v)
+		if b[i] != 0 {
+			m[i] = 255
+		}
+	}
+
+	f := ipfilter_t{}
+	f.mask = uint32(m[0])<<24 | uint32(m[1])<<16 | uint32(m[2])<<8 | uint32(m[3])
+	f.compare = uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+	return f, true
+}
+
+/*
+ * Returns true if the address is matched
+ * by one of the filters. The port and
+ * everything that isn't an IPv4 address
+ * is ignored.
+ */
+func matchFilter(from string) bool {
+	var m [4]uint32
+
+	if i := strings.LastIndex(from, ":"); i >= 0 {
+		from = from[:i]
+	}
+
+	parts := strings.Split(from, ".")
+	if len(parts) != 4 {
+		return false
+	}
+
+	for i, p := range parts {
+		v, err := strconv.ParseUint(p, 10, 8)
+		if err != nil {
+			return false
+		}
+		m[i] = uint32(v)
+	}
+
+	in := m[0]<<24 | m[1]<<16 | m[2]<<8 | m[3]
+
+	ipfilters_mu.Lock()
+	defer ipfilters_mu.Unlock()
+
+	for _, f := range ipfilters {
+		if (in & f.mask) == f.compare {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+ * Reads the filters written by writeip. This
+ * happens only once, all games share the list.
+ */
+func LoadIPFilters(gamedir string) {
+	ipfilters_loaded.Do(func() {
+		bfr, err := os.ReadFile(gamedir + "/listip.cfg")
+		if err != nil {
+			return
+		}
+
+		ipfilters_mu.Lock()
+		defer ipfilters_mu.Unlock()
+
+		for _, line := range strings.Split(string(bfr), "\n") {
+			args := shared.Cmd_TokenizeString(line, false)
+
+			if (len(args) == 3) && (args[0] == "set") && (args[1] == "filterban") {
+				ipfilterban = args[2] != "0"
+			} else if (len(args) == 3) && (args[0] == "sv") && (args[1] == "addip") {
+				if f, ok := stringToFilter(args[2]); ok {
+					ipfilters = append(ipfilters, f)
+				}
+			}
+		}
+	})
+}
+
+/*
+ * Checks an address the manager is about to
+ * accept, with the same setting as the games.
+ */
+func AddressFiltered(from string) bool {
+	matched := matchFilter(from)
+
+	ipfilters_mu.Lock()
+	defer ipfilters_mu.Unlock()
+
+	if matched {
+		return ipfilterban
+	}
+
+	return !ipfilterban
+}
+
+/*
+ * Setting the filterban cvar of a game changes
+ * the setting of all games, the cvar of the
+ * other games is updated when they use it.
+ */
+func (G *qGame) syncFilterban() bool {
+	ipfilters_mu.Lock()
+	defer ipfilters_mu.Unlock()
+
+	if G.filterban.Modified {
+		ipfilterban = G.filterban.Bool()
+	} else if G.filterban.Bool() != ipfilterban {
+		if ipfilterban {
+			G.gi.CvarSet("filterban", "1")
+		} else {
+			G.gi.CvarSet("filterban", "0")
+		}
+	}
+	G.filterban.Modified = false
+
+	return ipfilterban
+}
+
+func (G *qGame) svFilterPacket(from string) bool {
+	filterban := G.syncFilterban()
+
+	if matchFilter(from) {
+		return filterban
+	}
+
+	return !filterban
+}
+
+func (G *qGame) svCmd_Test_f() {
+	G.gi.Cprintf(nil, shared.PRINT_HIGH, "Svcmd_Test_f()\n")
+}
+
+func (G *qGame) svCmd_AddIP_f() {
+	if G.gi.Argc() < 3 {
+		G.gi.Cprintf(nil, shared.PRINT_HIGH, "Usage:  addip <ip-mask>\n")
+		return
+	}
+
+	f, ok := stringToFilter(G.gi.Argv(2))
+	if !ok {
+		G.gi.Cprintf(nil, shared.PRINT_HIGH, "Bad filter address: %s\n", G.gi.Argv(2))
+		return
+	}
+
+	ipfilters_mu.Lock()
+	defer ipfilters_mu.Unlock()
+
+	for _, o := range ipfilters {
+		if o == f {
+			return /* already in the list */
+		}
+	}
+
+	if len(ipfilters) == MAX_IPFILTERS {
+		G.gi.Cprintf(nil, shared.PRINT_HIGH, "IP filter list is full\n")
+		return
+	}
+
+	ipfilters = append(ipfilters, f)
+}
+
+func (G *qGame) svCmd_RemoveIP_f() {
+	if G.gi.Argc() < 3 {
+		G.gi.Cprintf(nil, shared.PRINT_HIGH, "Usage:  sv removeip <ip-mask>\n")
+		return
+	}
+
+	f, ok := stringToFilter(G.gi.Argv(2))
+	if !ok {
+		G.gi.Cprintf(nil, shared.PRINT_HIGH, "Bad filter address: %s\n", G.gi.Argv(2))
+		return
+	}
+
+	ipfilters_mu.Lock()
+	defer ipfilters_mu.Unlock()
+
+	for i, o := range ipfilters {
+		if o == f {
+			ipfilters = append(ipfilters[:i], ipfilters[i+1:]...)
+			G.gi.Cprintf(nil, shared.PRINT_HIGH, "Removed.\n")
+			return
+		}
+	}
+
+	G.gi.Cprintf(nil, shared.PRINT_HIGH, "Didn't find %s.\n", G.gi.Argv(2))
+}
+
+func filterToString(f ipfilter_t) string {
+	return fmt.Sprintf("%v.%v.%v.%v", byte(f.compare>>24), byte(f.compare>>16),
+		byte(f.compare>>8), byte(f.compare))
+}
+
+func (G *qGame) svCmd_ListIP_f() {
+	ipfilters_mu.Lock()
+	defer ipfilters_mu.Unlock()
+
+	G.gi.Cprintf(nil, shared.PRINT_HIGH, "Filter list:\n")
+
+	for _, f := range ipfilters {
+		G.gi.Cprintf(nil, shared.PRINT_HIGH, "%s\n", filterToString(f))
+	}
+}
+
+func (G *qGame) svCmd_WriteIP_f() {
+	name := G.gi.Gamedir() + "/listip.cfg"
+
+	G.gi.Cprintf(nil, shared.PRINT_HIGH, "Writing %s.\n", name)
+
+	str := "set filterban 0\n"
+	if G.syncFilterban() {
+		str = "set filterban 1\n"
+	}
+
+	ipfilters_mu.Lock()
+	for _, f := range ipfilters {
+		str += fmt.Sprintf("sv addip %s\n", filterToString(f))
+	}
+	ipfilters_mu.Unlock()
+
+	if err := os.WriteFile(name, []byte(str), 0644); err != nil {
+		G.gi.Cprintf(nil, shared.PRINT_HIGH, "Couldn't open %s\n", name)
+	}
+}
+
+/*
+ * ServerCommand will be called when an "sv" command is issued.
+ * The game can issue gi.argc() / gi.argv() commands to get the
+ * rest of the parameters
+ */
+func (G *qGame) ServerCommand() {
+
+	cmd := G.gi.Argv(1)
+
+	if strings.EqualFold(cmd, "test") {
+		G.svCmd_Test_f()
+	} else if strings.EqualFold(cmd, "addip") {
+		G.svCmd_AddIP_f()
+	} else if strings.EqualFold(cmd, "removeip") {
+		G.svCmd_RemoveIP_f()
+	} else if strings.EqualFold(cmd, "listip") {
+		G.svCmd_ListIP_f()
+	} else if strings.EqualFold(cmd, "writeip") {
+		G.svCmd_WriteIP_f()
+	} else {
+		G.gi.Cprintf(nil, shared.PRINT_HIGH, "Unknown server command \"%s\"\n", cmd)
+	}
+}
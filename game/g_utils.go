@@ -177,14 +177,14 @@ func (G *qGame) gUseTargets(ent, activator *edict_t) {
 
 	/* print the message */
 	if len(ent.Message) > 0 && (activator.svflags&shared.SVF_MONSTER) == 0 {
-		//  gi.centerprintf(activator, "%s", ent->message);
-
-		//  if (ent->noise_index) {
-		// 	 gi.sound(activator, CHAN_AUTO, ent->noise_index, 1, ATTN_NORM, 0);
-		//  } else {
-		// 	 gi.sound(activator, CHAN_AUTO, gi.soundindex(
-		// 					 "misc/talk1.wav"), 1, ATTN_NORM, 0);
-		//  }
+		G.gi.Centerprintf(activator, "%s", ent.Message)
+
+		if ent.noise_index != 0 {
+			G.gi.Sound(activator, shared.CHAN_AUTO, ent.noise_index, 1, shared.ATTN_NORM, 0)
+		} else {
+			G.gi.Sound(activator, shared.CHAN_AUTO, G.gi.Soundindex(
+				"misc/talk1.wav"), 1, shared.ATTN_NORM, 0)
+		}
 	}
 
 	/* kill killtargets */
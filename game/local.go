@@ -687,6 +687,10 @@ func (G *gclient_t) Ping() int {
 	return G.ping
 }
 
+func (G *gclient_t) SetPing(v int) {
+	G.ping = v
+}
+
 func (G *gclient_t) copy(other gclient_t) {
 	/* known to server */
 	G.ps.Copy(other.ps)
@@ -916,6 +920,10 @@ func (G *edict_t) Inuse() bool {
 	return G.inuse
 }
 
+func (G *edict_t) SetInuse(v bool) {
+	G.inuse = v
+}
+
 func (G *edict_t) Linkcount() int {
 	return G.linkcount
 }
@@ -1223,7 +1231,9 @@ type qGame struct {
 
 	pushed   [shared.MAX_EDICTS]pushed_t
 	pushed_i int
-	obstacle *edict_t
+
+	player_die_i int /* cycles the death animations */
+	obstacle     *edict_t
 
 	jacket_armor_index int
 	combat_armor_index int
@@ -1231,6 +1241,17 @@ type qGame struct {
 	power_screen_index int
 	power_shield_index int
 
+	soldier_sound_idle        int
+	soldier_sound_sight1      int
+	soldier_sound_sight2      int
+	soldier_sound_pain_light  int
+	soldier_sound_pain        int
+	soldier_sound_pain_ss     int
+	soldier_sound_death_light int
+	soldier_sound_death       int
+	soldier_sound_death_ss    int
+	soldier_sound_cock        int
+
 	do_pickup_Weapon func(ent, other *edict_t, G *qGame) bool
 	do_pickup_Ammo   func(ent, other *edict_t, G *qGame) bool
 }
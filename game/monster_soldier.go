@@ -38,9 +38,9 @@ func soldier_idle(self *edict_t, G *qGame) {
 		return
 	}
 
-	// if (random() > 0.8) {
-	// 	gi.sound(self, CHAN_VOICE, sound_idle, 1, ATTN_IDLE, 0);
-	// }
+	if shared.Frandk() > 0.8 {
+		G.gi.Sound(self, shared.CHAN_VOICE, G.soldier_sound_idle, 1, shared.ATTN_IDLE, 0)
+	}
 }
 
 func soldier_cock(self *edict_t, G *qGame) {
@@ -48,14 +48,11 @@ func soldier_cock(self *edict_t, G *qGame) {
 		return
 	}
 
-	// if (self->s.frame == FRAME_stand322)
-	// {
-	// 	gi.sound(self, CHAN_WEAPON, sound_cock, 1, ATTN_IDLE, 0);
-	// }
-	// else
-	// {
-	// 	gi.sound(self, CHAN_WEAPON, sound_cock, 1, ATTN_NORM, 0);
-	// }
+	if self.s.Frame == soldier.FRAME_stand322 {
+		G.gi.Sound(self, shared.CHAN_WEAPON, G.soldier_sound_cock, 1, shared.ATTN_IDLE, 0)
+	} else {
+		G.gi.Sound(self, shared.CHAN_WEAPON, G.soldier_sound_cock, 1, shared.ATTN_NORM, 0)
+	}
 }
 
 var soldier_frames_stand1 = []mframe_t{
@@ -410,20 +407,15 @@ func soldier_pain(self, other *edict_t, kick float32, damage int, G *qGame) {
 
 	self.pain_debounce_time = G.level.time + 3
 
-	// n := self.s.skinnum | 1;
+	n := self.s.Skinnum | 1
 
-	// if (n == 1)
-	// {
-	// 	gi.sound(self, CHAN_VOICE, sound_pain_light, 1, ATTN_NORM, 0);
-	// }
-	// else if (n == 3)
-	// {
-	// 	gi.sound(self, CHAN_VOICE, sound_pain, 1, ATTN_NORM, 0);
-	// }
-	// else
-	// {
-	// 	gi.sound(self, CHAN_VOICE, sound_pain_ss, 1, ATTN_NORM, 0);
-	// }
+	if n == 1 {
+		G.gi.Sound(self, shared.CHAN_VOICE, G.soldier_sound_pain_light, 1, shared.ATTN_NORM, 0)
+	} else if n == 3 {
+		G.gi.Sound(self, shared.CHAN_VOICE, G.soldier_sound_pain, 1, shared.ATTN_NORM, 0)
+	} else {
+		G.gi.Sound(self, shared.CHAN_VOICE, G.soldier_sound_pain_ss, 1, shared.ATTN_NORM, 0)
+	}
 
 	if self.velocity[2] > 100 {
 		self.monsterinfo.currentmove = &soldier_move_pain4
@@ -879,11 +871,11 @@ func soldier_sight(self, other *edict_t, G *qGame) {
 		return
 	}
 
-	// if (random() < 0.5) {
-	// 	gi.sound(self, CHAN_VOICE, sound_sight1, 1, ATTN_NORM, 0);
-	// } else {
-	// 	gi.sound(self, CHAN_VOICE, sound_sight2, 1, ATTN_NORM, 0);
-	// }
+	if shared.Frandk() < 0.5 {
+		G.gi.Sound(self, shared.CHAN_VOICE, G.soldier_sound_sight1, 1, shared.ATTN_NORM, 0)
+	} else {
+		G.gi.Sound(self, shared.CHAN_VOICE, G.soldier_sound_sight2, 1, shared.ATTN_NORM, 0)
+	}
 
 	if (G.skill.Int() > SKILL_EASY) && (range_(self, self.enemy) >= RANGE_MID) {
 		if shared.Frandk() > 0.5 {
@@ -1230,13 +1222,13 @@ func soldier_die(self, inflictor, attacker *edict_t, damage int, point []float32
 	self.takedamage = DAMAGE_YES
 	self.s.Skinnum |= 1
 
-	// if (self.s.skinnum == 1) {
-	// 	gi.sound(self, CHAN_VOICE, sound_death_light, 1, ATTN_NORM, 0);
-	// } else if (self.s.skinnum == 3) {
-	// 	gi.sound(self, CHAN_VOICE, sound_death, 1, ATTN_NORM, 0);
-	// } else {
-	// 	gi.sound(self, CHAN_VOICE, sound_death_ss, 1, ATTN_NORM, 0);
-	// }
+	if self.s.Skinnum == 1 {
+		G.gi.Sound(self, shared.CHAN_VOICE, G.soldier_sound_death_light, 1, shared.ATTN_NORM, 0)
+	} else if self.s.Skinnum == 3 {
+		G.gi.Sound(self, shared.CHAN_VOICE, G.soldier_sound_death, 1, shared.ATTN_NORM, 0)
+	} else {
+		G.gi.Sound(self, shared.CHAN_VOICE, G.soldier_sound_death_ss, 1, shared.ATTN_NORM, 0)
+	}
 
 	if math.Abs(float64((self.s.Origin[2]+float32(self.viewheight))-point[2])) <= 4 {
 		/* head shot */
@@ -1277,10 +1269,10 @@ func (G *qGame) spMonsterSoldierX(self *edict_t) {
 	self.movetype = MOVETYPE_STEP
 	self.solid = shared.SOLID_BBOX
 
-	// sound_idle = gi.soundindex("soldier/solidle1.wav");
-	// sound_sight1 = gi.soundindex("soldier/solsght1.wav");
-	// sound_sight2 = gi.soundindex("soldier/solsrch1.wav");
-	// sound_cock = gi.soundindex("infantry/infatck3.wav");
+	G.soldier_sound_idle = G.gi.Soundindex("soldier/solidle1.wav")
+	G.soldier_sound_sight1 = G.gi.Soundindex("soldier/solsght1.wav")
+	G.soldier_sound_sight2 = G.gi.Soundindex("soldier/solsrch1.wav")
+	G.soldier_sound_cock = G.gi.Soundindex("infantry/infatck3.wav")
 
 	self.Mass = 100
 
@@ -1317,8 +1309,8 @@ func spMonsterSoldier(self *edict_t, G *qGame) error {
 
 	G.spMonsterSoldierX(self)
 
-	// sound_pain = gi.soundindex("soldier/solpain1.wav");
-	// sound_death = gi.soundindex("soldier/soldeth1.wav");
+	G.soldier_sound_pain = G.gi.Soundindex("soldier/solpain1.wav")
+	G.soldier_sound_death = G.gi.Soundindex("soldier/soldeth1.wav")
 	G.gi.Soundindex("soldier/solatck1.wav")
 
 	self.s.Skinnum = 2
@@ -27,6 +27,7 @@ package game
 
 import (
 	"fmt"
+	"quake2srv/game/misc"
 	"quake2srv/shared"
 	"strconv"
 )
@@ -41,6 +42,282 @@ func player_pain(self, other *edict_t, kick float32, damage int, G *qGame) {
 	 * a pain callback */
 }
 
+func isFemale(ent *edict_t) bool {
+	if (ent == nil) || (ent.client == nil) {
+		return false
+	}
+
+	info := shared.Info_ValueForKey(ent.client.pers.userinfo, "gender")
+	return (len(info) > 0) && ((info[0] == 'f') || (info[0] == 'F'))
+}
+
+func isNeutral(ent *edict_t) bool {
+	if (ent == nil) || (ent.client == nil) {
+		return false
+	}
+
+	info := shared.Info_ValueForKey(ent.client.pers.userinfo, "gender")
+	return (len(info) == 0) || ((info[0] != 'f') && (info[0] != 'F') &&
+		(info[0] != 'm') && (info[0] != 'M'))
+}
+
+func (G *qGame) clientObituary(self, inflictor, attacker *edict_t) {
+	if (self == nil) || (inflictor == nil) {
+		return
+	}
+
+	if G.coop.Bool() && (attacker != nil) && (attacker.client != nil) {
+		G.meansOfDeath |= MOD_FRIENDLY_FIRE
+	}
+
+	if G.deathmatch.Bool() || G.coop.Bool() {
+		ff := (G.meansOfDeath & MOD_FRIENDLY_FIRE) != 0
+		mod := G.meansOfDeath &^ MOD_FRIENDLY_FIRE
+		message := ""
+		message2 := ""
+
+		switch mod {
+		case MOD_SUICIDE:
+			message = "suicides"
+		case MOD_FALLING:
+			message = "cratered"
+		case MOD_CRUSH:
+			message = "was squished"
+		case MOD_WATER:
+			message = "sank like a rock"
+		case MOD_SLIME:
+			message = "melted"
+		case MOD_LAVA:
+			message = "does a back flip into the lava"
+		case MOD_EXPLOSIVE, MOD_BARREL:
+			message = "blew up"
+		case MOD_EXIT:
+			message = "found a way out"
+		case MOD_TARGET_LASER:
+			message = "saw the light"
+		case MOD_TARGET_BLASTER:
+			message = "got blasted"
+		case MOD_BOMB, MOD_SPLASH, MOD_TRIGGER_HURT:
+			message = "was in the wrong place"
+		}
+
+		if attacker == self {
+			switch mod {
+			case MOD_HELD_GRENADE:
+				message = "tried to put the pin back in"
+			case MOD_HG_SPLASH, MOD_G_SPLASH:
+				if isNeutral(self) {
+					message = "tripped on its own grenade"
+				} else if isFemale(self) {
+					message = "tripped on her own grenade"
+				} else {
+					message = "tripped on his own grenade"
+				}
+			case MOD_R_SPLASH:
+				if isNeutral(self) {
+					message = "blew itself up"
+				} else if isFemale(self) {
+					message = "blew herself up"
+				} else {
+					message = "blew himself up"
+				}
+			case MOD_BFG_BLAST:
+				message = "should have used a smaller gun"
+			default:
+				if isNeutral(self) {
+					message = "killed itself"
+				} else if isFemale(self) {
+					message = "killed herself"
+				} else {
+					message = "killed himself"
+				}
+			}
+		}
+
+		if len(message) > 0 {
+			G.gi.Bprintf(shared.PRINT_MEDIUM, "%s %s.\n", self.client.pers.netname, message)
+			if G.deathmatch.Bool() {
+				self.client.resp.score--
+			}
+			self.enemy = nil
+			return
+		}
+
+		self.enemy = attacker
+
+		if (attacker != nil) && (attacker.client != nil) {
+			switch mod {
+			case MOD_BLASTER:
+				message = "was blasted by"
+			case MOD_SHOTGUN:
+				message = "was gunned down by"
+			case MOD_SSHOTGUN:
+				message = "was blown away by"
+				message2 = "'s super shotgun"
+			case MOD_MACHINEGUN:
+				message = "was machinegunned by"
+			case MOD_CHAINGUN:
+				message = "was cut in half by"
+				message2 = "'s chaingun"
+			case MOD_GRENADE:
+				message = "was popped by"
+				message2 = "'s grenade"
+			case MOD_G_SPLASH:
+				message = "was shredded by"
+				message2 = "'s shrapnel"
+			case MOD_ROCKET:
+				message = "ate"
+				message2 = "'s rocket"
+			case MOD_R_SPLASH:
+				message = "almost dodged"
+				message2 = "'s rocket"
+			case MOD_HYPERBLASTER:
+				message = "was melted by"
+				message2 = "'s hyperblaster"
+			case MOD_RAILGUN:
+				message = "was railed by"
+			case MOD_BFG_LASER:
+				message = "saw the pretty lights from"
+				message2 = "'s BFG"
+			case MOD_BFG_BLAST:
+				message = "was disintegrated by"
+				message2 = "'s BFG blast"
+			case MOD_BFG_EFFECT:
+				message = "couldn't hide from"
+				message2 = "'s BFG"
+			case MOD_HANDGRENADE:
+				message = "caught"
+				message2 = "'s handgrenade"
+			case MOD_HG_SPLASH:
+				message = "didn't see"
+				message2 = "'s handgrenade"
+			case MOD_HELD_GRENADE:
+				message = "feels"
+				message2 = "'s pain"
+			case MOD_TELEFRAG:
+				message = "tried to invade"
+				message2 = "'s personal space"
+			}
+
+			if len(message) > 0 {
+				G.gi.Bprintf(shared.PRINT_MEDIUM, "%s %s %s%s\n", self.client.pers.netname,
+					message, attacker.client.pers.netname, message2)
+
+				if G.deathmatch.Bool() {
+					if ff {
+						attacker.client.resp.score--
+					} else {
+						attacker.client.resp.score++
+					}
+				}
+				return
+			}
+		}
+	}
+
+	G.gi.Bprintf(shared.PRINT_MEDIUM, "%s died.\n", self.client.pers.netname)
+
+	if G.deathmatch.Bool() {
+		self.client.resp.score--
+	}
+}
+
+func player_die(self, inflictor, attacker *edict_t, damage int, point []float32, G *qGame) {
+	if (self == nil) || (inflictor == nil) || (attacker == nil) {
+		return
+	}
+
+	self.avelocity = [3]float32{}
+
+	self.takedamage = DAMAGE_YES
+	self.movetype = MOVETYPE_TOSS
+
+	self.s.Modelindex2 = 0 /* remove linked weapon model */
+
+	self.s.Angles[0] = 0
+	self.s.Angles[2] = 0
+
+	self.s.Sound = 0
+	//  self->client->weapon_sound = 0;
+
+	self.maxs[2] = -8
+
+	self.svflags |= shared.SVF_DEADMONSTER
+
+	if self.deadflag == DEAD_NO {
+		//  self->client->respawn_time = level.time + 1.0;
+		//  LookAtKiller(self, inflictor, attacker);
+		self.client.ps.Pmove.Pm_type = shared.PM_DEAD
+		G.clientObituary(self, inflictor, attacker)
+		//  TossClientWeapon(self);
+
+		//  if (deathmatch->value) {
+		// 	 Cmd_Help_f(self); /* show scores */
+		//  }
+
+		/* clear inventory: this is kind of ugly, but
+		   it's how we want to handle keys in coop */
+		for n := 0; n < G.game.num_items; n++ {
+			if G.coop.Bool() && (gameitemlist[n].flags&IT_KEY) != 0 {
+				self.client.resp.coop_respawn.inventory[n] = self.client.pers.inventory[n]
+			}
+
+			self.client.pers.inventory[n] = 0
+		}
+	}
+
+	//  /* remove powerups */
+	//  self->client->quad_framenum = 0;
+	//  self->client->invincible_framenum = 0;
+	//  self->client->breather_framenum = 0;
+	//  self->client->enviro_framenum = 0;
+	//  self->flags &= ~FL_POWER_ARMOR;
+
+	if self.Health < -40 {
+		/* gib */
+		G.gi.Sound(self, shared.CHAN_BODY, G.gi.Soundindex("misc/udeath.wav"), 1, shared.ATTN_NORM, 0)
+
+		//  for (n = 0; n < 4; n++) {
+		// 	 ThrowGib(self, "models/objects/gibs/sm_meat/tris.md2", damage, GIB_ORGANIC);
+		//  }
+		//  ThrowClientHead(self, damage);
+
+		self.takedamage = DAMAGE_NO
+	} else {
+		/* normal death */
+		if self.deadflag == DEAD_NO {
+			G.player_die_i = (G.player_die_i + 1) % 3
+
+			/* start a death animation */
+			self.client.anim_priority = ANIM_DEATH
+
+			if (self.client.ps.Pmove.Pm_flags & shared.PMF_DUCKED) != 0 {
+				self.s.Frame = misc.FRAME_crdeath1 - 1
+				self.client.anim_end = misc.FRAME_crdeath5
+			} else {
+				switch G.player_die_i {
+				case 0:
+					self.s.Frame = misc.FRAME_death101 - 1
+					self.client.anim_end = misc.FRAME_death106
+				case 1:
+					self.s.Frame = misc.FRAME_death201 - 1
+					self.client.anim_end = misc.FRAME_death206
+				case 2:
+					self.s.Frame = misc.FRAME_death301 - 1
+					self.client.anim_end = misc.FRAME_death308
+				}
+			}
+
+			G.gi.Sound(self, shared.CHAN_VOICE, G.gi.Soundindex(
+				fmt.Sprintf("*death%v.wav", (shared.Randk()%4)+1)), 1, shared.ATTN_NORM, 0)
+		}
+	}
+
+	self.deadflag = DEAD_DEAD
+
+	G.gi.Linkentity(self)
+}
+
 /* ======================================================================= */
 
 /*
@@ -412,7 +689,7 @@ func (G *qGame) putClientInServer(ent *edict_t) error {
 	ent.clipmask = shared.MASK_PLAYERSOLID
 	ent.Model = "players/male/tris.md2"
 	ent.pain = player_pain
-	//  ent->die = player_die;
+	ent.die = player_die
 	ent.waterlevel = 0
 	ent.watertype = 0
 	ent.flags &^= FL_NO_KNOCKBACK
@@ -763,10 +1040,10 @@ func (G *qGame) ClientBegin(sent shared.Edict_s) error {
 		connecting to the server, which is different than the
 		state when the game is saved, so we need to compensate
 		with deltaangles */
-		//  for i := 0; i < 3; i++ {
-		// 	 ent->client->ps.pmove.delta_angles[i] = ANGLE2SHORT(
-		// 			 ent->client->ps.viewangles[i]);
-		//  }
+		for i := 0; i < 3; i++ {
+			ent.client.ps.Pmove.Delta_angles[i] = shared.ANGLE2SHORT(
+				ent.client.ps.Viewangles[i])
+		}
 	} else {
 		/* a spawn point will completely reinitialize the entity
 		except for the persistant data that was initialized at
@@ -782,16 +1059,16 @@ func (G *qGame) ClientBegin(sent shared.Edict_s) error {
 	//  if (level.intermissiontime) {
 	// 	 MoveClientToIntermission(ent);
 	//  } else {
-	// 	 /* send effect if in a multiplayer game */
-	// 	 if (game.maxclients > 1) {
-	// 		 gi.WriteByte(svc_muzzleflash);
-	// 		 gi.WriteShort(ent - g_edicts);
-	// 		 gi.WriteByte(MZ_LOGIN);
-	// 		 gi.multicast(ent->s.origin, MULTICAST_PVS);
-
-	// 		 gi.bprintf(PRINT_HIGH, "%s entered the game\n",
-	// 				 ent->client->pers.netname);
-	// 	 }
+	/* send effect if in a multiplayer game */
+	if G.game.maxclients > 1 {
+		G.gi.WriteByte(shared.SvcMuzzleflash)
+		G.gi.WriteShort(ent.index)
+		G.gi.WriteByte(shared.MZ_LOGIN)
+		G.gi.Multicast(ent.s.Origin[:], shared.MULTICAST_PVS)
+
+		G.gi.Bprintf(shared.PRINT_HIGH, "%s entered the game\n",
+			ent.client.pers.netname)
+	}
 	//  }
 
 	/* make sure all view stuff is valid */
@@ -811,9 +1088,9 @@ func (G *qGame) clientUserinfoChanged(ent *edict_t, userinfo string) {
 	}
 
 	/* check for malformed or illegal info strings */
-	// if !Info_Validate(userinfo) {
-	// 	strcpy(userinfo, "\\name\\badinfo\\skin\\male/grunt")
-	// }
+	if !shared.Info_Validate(userinfo) {
+		userinfo = "\\name\\badinfo\\skin\\male/grunt"
+	}
 
 	/* set name */
 	s := shared.Info_ValueForKey(userinfo, "name")
@@ -864,6 +1141,21 @@ func (G *qGame) clientUserinfoChanged(ent *edict_t, userinfo string) {
 	ent.client.pers.userinfo = userinfo
 }
 
+/*
+ * Called whenever the player updates a userinfo variable.
+ * The game can override any of the settings in place
+ * (forcing skins or names, etc) before copying it off.
+ */
+func (G *qGame) ClientUserinfoChanged(sent shared.Edict_s, userinfo string) {
+
+	ent := sent.(*edict_t)
+	if ent == nil || ent.client == nil {
+		return
+	}
+
+	G.clientUserinfoChanged(ent, userinfo)
+}
+
 /*
  * Called when a player begins connecting to the server.
  * The game can refuse entrance to a client by returning false.
@@ -879,12 +1171,12 @@ func (G *qGame) ClientConnect(sent shared.Edict_s, userinfo string) bool {
 	}
 
 	/* check to see if they are on the banned IP list */
-	// value := shared.Info_ValueForKey(userinfo, "ip")
+	value := shared.Info_ValueForKey(userinfo, "ip")
 
-	//  if (SV_FilterPacket(value)) {
-	// 	 Info_SetValueForKey(userinfo, "rejmsg", "Banned.");
-	// 	 return false;
-	//  }
+	if G.svFilterPacket(value) {
+		// 	 Info_SetValueForKey(userinfo, "rejmsg", "Banned.");
+		return false
+	}
 
 	//  /* check for a spectator */
 	//  value = Info_ValueForKey(userinfo, "spectator");
@@ -957,6 +1249,48 @@ func (G *qGame) ClientConnect(sent shared.Edict_s, userinfo string) bool {
 	return true
 }
 
+/*
+ * Called when a player drops from the server.
+ * Will not be called between levels.
+ */
+func (G *qGame) ClientDisconnect(sent shared.Edict_s) {
+
+	ent := sent.(*edict_t)
+	if ent == nil {
+		return
+	}
+
+	if ent.client == nil {
+		return
+	}
+
+	G.gi.Bprintf(shared.PRINT_HIGH, "%s disconnected\n", ent.client.pers.netname)
+
+	/* send effect */
+	if ent.inuse {
+		G.gi.WriteByte(shared.SvcMuzzleflash)
+		G.gi.WriteShort(ent.index)
+		G.gi.WriteByte(shared.MZ_LOGOUT)
+		G.gi.Multicast(ent.s.Origin[:], shared.MULTICAST_PVS)
+	}
+
+	G.gi.Unlinkentity(ent)
+	ent.s.Modelindex = 0
+	ent.s.Sound = 0
+	ent.s.Event = 0
+	ent.s.Effects = 0
+	ent.s.Renderfx = 0
+	ent.s.Solid = 0
+	ent.solid = shared.SOLID_NOT
+	ent.inuse = false
+	ent.Classname = "disconnected"
+	ent.client.pers.connected = false
+
+	/* FIXME: Don't break skins on corpses, etc. */
+	//playernum = ent-g_edicts-1;
+	//gi.configstring (CS_PLAYERSKINS+playernum, "");
+}
+
 /* ============================================================== */
 
 // edict_t *pm_passent;
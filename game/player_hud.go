@@ -25,7 +25,139 @@
  */
 package game
 
-import "quake2srv/shared"
+import (
+	"fmt"
+	"quake2srv/shared"
+)
+
+/* ======================================================================= */
+
+func (G *qGame) deathmatchScoreboardMessage(ent, killer *edict_t) {
+
+	if ent == nil { /* killer can be NULL */
+		return
+	}
+
+	/* sort the clients by score */
+	var sorted [shared.MAX_CLIENTS]int
+	var sortedscores [shared.MAX_CLIENTS]int
+	total := 0
+
+	for i := 0; i < G.game.maxclients; i++ {
+		cl_ent := &G.g_edicts[1+i]
+
+		if !cl_ent.inuse || G.game.clients[i].resp.spectator {
+			continue
+		}
+
+		score := G.game.clients[i].resp.score
+
+		j := 0
+		for j = 0; j < total; j++ {
+			if score > sortedscores[j] {
+				break
+			}
+		}
+
+		for k := total; k > j; k-- {
+			sorted[k] = sorted[k-1]
+			sortedscores[k] = sortedscores[k-1]
+		}
+
+		sorted[j] = i
+		sortedscores[j] = score
+		total++
+	}
+
+	/* print level name and exit rules */
+	str := ""
+
+	/* add the clients in sorted order */
+	if total > 12 {
+		total = 12
+	}
+
+	for i := 0; i < total; i++ {
+		cl := &G.game.clients[sorted[i]]
+		cl_ent := &G.g_edicts[1+sorted[i]]
+
+		x := 0
+		if i >= 6 {
+			x = 160
+		}
+		y := 32 + 32*(i%6)
+
+		/* add a dogtag */
+		tag := ""
+		if cl_ent == ent {
+			tag = "tag1"
+		} else if cl_ent == killer {
+			tag = "tag2"
+		}
+
+		if len(tag) > 0 {
+			entry := fmt.Sprintf("xv %v yv %v picn %s ", x+32, y, tag)
+
+			if len(str)+len(entry) > 1024 {
+				break
+			}
+
+			str += entry
+		}
+
+		/* send the layout */
+		entry := fmt.Sprintf("client %v %v %v %v %v %v ",
+			x, y, sorted[i], cl.resp.score, cl.ping,
+			(G.level.framenum-cl.resp.enterframe)/600)
+
+		if len(str)+len(entry) > 1024 {
+			break
+		}
+
+		str += entry
+	}
+
+	G.gi.WriteByte(shared.SvcLayout)
+	G.gi.WriteString(str)
+}
+
+/*
+ * Draw instead of help message.
+ * Note that it isn't that hard to
+ * overflow the 1400 byte message limit!
+ */
+func (G *qGame) deathmatchScoreboard(ent *edict_t) {
+	if ent == nil {
+		return
+	}
+
+	G.deathmatchScoreboardMessage(ent, ent.enemy)
+	G.gi.Unicast(ent, true)
+}
+
+/*
+ * Display the scoreboard
+ */
+func (G *qGame) cmd_Score_f(ent *edict_t) {
+	if ent == nil {
+		return
+	}
+
+	ent.client.showinventory = false
+	ent.client.showhelp = false
+
+	if !G.deathmatch.Bool() && !G.coop.Bool() {
+		return
+	}
+
+	if ent.client.showscores {
+		ent.client.showscores = false
+		return
+	}
+
+	ent.client.showscores = true
+	G.deathmatchScoreboard(ent)
+}
 
 /* ======================================================================= */
 
@@ -144,16 +276,14 @@ func (G *qGame) gSetStats(ent *edict_t) {
 	ent.client.ps.Stats[shared.STAT_LAYOUTS] = 0
 
 	if G.deathmatch.Bool() {
-		// 	if ((ent->client->pers.health <= 0) || level.intermissiontime ||
-		// 		ent->client->showscores)
-		// 	{
-		// 		ent->client->ps.stats[STAT_LAYOUTS] |= 1;
-		// 	}
-
-		// 	if (ent->client->showinventory && (ent->client->pers.health > 0))
-		// 	{
-		// 		ent->client->ps.stats[STAT_LAYOUTS] |= 2;
-		// 	}
+		if (ent.client.pers.health <= 0) || G.level.intermissiontime != 0 ||
+			ent.client.showscores {
+			ent.client.ps.Stats[shared.STAT_LAYOUTS] |= 1
+		}
+
+		if ent.client.showinventory && (ent.client.pers.health > 0) {
+			ent.client.ps.Stats[shared.STAT_LAYOUTS] |= 2
+		}
 	} else {
 		if ent.client.showscores || ent.client.showhelp {
 			ent.client.ps.Stats[shared.STAT_LAYOUTS] |= 1
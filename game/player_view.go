@@ -301,12 +301,11 @@ func (G *qGame) clientEndServerFrame(ent *edict_t) {
 	copy(ent.client.kick_angles[:], []float32{0, 0, 0})
 
 	if (G.level.framenum & 31) == 0 {
-		// 	 /* if the scoreboard is up, update it */
-		// 	 if (ent->client->showscores)
-		// 	 {
-		// 		 DeathmatchScoreboardMessage(ent, ent->enemy);
-		// 		 gi.unicast(ent, false);
-		// 	 }
+		/* if the scoreboard is up, update it */
+		if ent.client.showscores {
+			G.deathmatchScoreboardMessage(ent, ent.enemy)
+			G.gi.Unicast(ent, false)
+		}
 
 		// 	 /* if the help computer is up, update it */
 		// 	 if (ent->client->showhelp)
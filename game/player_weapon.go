@@ -418,12 +418,11 @@ func (G *qGame) weapon_Generic(ent *edict_t, FRAME_ACTIVATE_LAST, FRAME_FIRE_LAS
 					ent.client.anim_end = misc.FRAME_attack8
 				}
 			} else {
-				// 			 if (level.time >= ent->pain_debounce_time)
-				// 			 {
-				// 				 gi.sound(ent, CHAN_VOICE, gi.soundindex(
-				// 							 "weapons/noammo.wav"), 1, ATTN_NORM, 0);
-				// 				 ent->pain_debounce_time = level.time + 1;
-				// 			 }
+				if G.level.time >= ent.pain_debounce_time {
+					G.gi.Sound(ent, shared.CHAN_VOICE, G.gi.Soundindex(
+						"weapons/noammo.wav"), 1, shared.ATTN_NORM, 0)
+					ent.pain_debounce_time = G.level.time + 1
+				}
 
 				// 			 NoAmmoWeaponChange(ent);
 			}
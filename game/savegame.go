@@ -27,7 +27,14 @@
  */
 package game
 
-import "quake2srv/shared"
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"quake2srv/shared"
+	"reflect"
+	"runtime"
+)
 
 /*
  * This is the Quake 2 savegame system, fixed by Yamagi
@@ -115,6 +122,12 @@ func (G *qGame) Init() {
 	G.spectator_password = G.gi.Cvar("spectator_password", "", shared.CVAR_USERINFO)
 	G.needpass = G.gi.Cvar("needpass", "0", shared.CVAR_SERVERINFO)
 	G.filterban = G.gi.Cvar("filterban", "1", 0)
+
+	/* the filter list is shared by all games,
+	   a new game starts with the shared setting */
+	LoadIPFilters(G.gi.Gamedir())
+	G.filterban.Modified = false
+	G.syncFilterban()
 	G.g_select_empty = G.gi.Cvar("g_select_empty", "0", shared.CVAR_ARCHIVE)
 	G.run_pitch = G.gi.Cvar("run_pitch", "0.002", 0)
 	G.run_roll = G.gi.Cvar("run_roll", "0.005", 0)
@@ -238,3 +251,1229 @@ var fields = []field_t{
 	// {"maxpitch", STOFS(maxpitch), F_FLOAT, FFL_SPAWNTEMP},
 	{"nextmap", "Nextmap", F_LSTRING, FFL_SPAWNTEMP},
 }
+
+/* ========================================================= */
+
+/*
+ * Savegame version. Increase this every time the layout of
+ * the savegame files changes, old savegames can't be loaded
+ * after that.
+ */
+const SAVEGAMEVER = "YQ2GO-1"
+
+/*
+ * Functions that can be referenced by edicts, moveinfo and
+ * monsterinfo. This is the Go equivalent of Yamagi's
+ * tables/gamefunc_list.h. Every function assigned to one
+ * of the callback fields must be listed here, otherwise
+ * the game can't be saved.
+ */
+var functionList = []struct {
+	funcStr string
+	funcPtr interface{}
+}{
+	{"angleMove_Begin", angleMove_Begin},
+	{"angleMove_Done", angleMove_Done},
+	{"angleMove_Final", angleMove_Final},
+	{"blaster_touch", blaster_touch},
+	{"door_go_down", door_go_down},
+	{"door_hit_bottom", door_hit_bottom},
+	{"door_hit_top", door_hit_top},
+	{"door_use", door_use},
+	{"droptofloor", droptofloor},
+	{"func_timer_think", func_timer_think},
+	{"gFreeEdictFunc", gFreeEdictFunc},
+	{"mCheckAttack", mCheckAttack},
+	{"misc_deadsoldier_die", misc_deadsoldier_die},
+	{"monster_think", monster_think},
+	{"monster_use", monster_use},
+	{"move_Begin", move_Begin},
+	{"move_Done", move_Done},
+	{"move_Final", move_Final},
+	{"multi_wait", multi_wait},
+	{"path_corner_touch", path_corner_touch},
+	{"player_die", player_die},
+	{"player_pain", player_pain},
+	{"point_combat_touch", point_combat_touch},
+	{"soldier_attack", soldier_attack},
+	{"soldier_attack1_refire1", soldier_attack1_refire1},
+	{"soldier_attack1_refire2", soldier_attack1_refire2},
+	{"soldier_attack2_refire1", soldier_attack2_refire1},
+	{"soldier_attack2_refire2", soldier_attack2_refire2},
+	{"soldier_attack3_refire", soldier_attack3_refire},
+	{"soldier_attack6_refire", soldier_attack6_refire},
+	{"soldier_cock", soldier_cock},
+	{"soldier_dead", soldier_dead},
+	{"soldier_die", soldier_die},
+	{"soldier_duck_up", soldier_duck_up},
+	{"soldier_fire1", soldier_fire1},
+	{"soldier_fire2", soldier_fire2},
+	{"soldier_fire3", soldier_fire3},
+	{"soldier_fire4", soldier_fire4},
+	{"soldier_fire6", soldier_fire6},
+	{"soldier_fire7", soldier_fire7},
+	{"soldier_fire8", soldier_fire8},
+	{"soldier_idle", soldier_idle},
+	{"soldier_pain", soldier_pain},
+	{"soldier_run", soldier_run},
+	{"soldier_sight", soldier_sight},
+	{"soldier_stand", soldier_stand},
+	{"soldier_walk", soldier_walk},
+	{"soldier_walk1_random", soldier_walk1_random},
+	{"spCreateUnnamedSpawn", spCreateUnnamedSpawn},
+	{"target_explosion_explode", target_explosion_explode},
+	{"think_AccelMove", think_AccelMove},
+	{"think_CalcMoveSpeed", think_CalcMoveSpeed},
+	{"think_Delay", think_Delay},
+	{"think_SpawnDoorTrigger", think_SpawnDoorTrigger},
+	{"touch_DoorTrigger", touch_DoorTrigger},
+	{"touch_Item", touch_Item},
+	{"touch_Multi", touch_Multi},
+	{"trigger_enable", trigger_enable},
+	{"trigger_relay_use", trigger_relay_use},
+	{"use_Item", use_Item},
+	{"use_Multi", use_Multi},
+	{"use_Target_Help", use_Target_Help},
+	{"use_target_explosion", use_target_explosion},
+	{"walkmonster_start_go", walkmonster_start_go},
+}
+
+/*
+ * All mmove_t that can be referenced by
+ * monsterinfo.currentmove. The Go equivalent
+ * of Yamagi's tables/gamemmove_list.h.
+ */
+var mmoveList = []struct {
+	mmoveStr string
+	mmovePtr *mmove_t
+}{
+	{"soldier_move_attack1", &soldier_move_attack1},
+	{"soldier_move_attack2", &soldier_move_attack2},
+	{"soldier_move_attack3", &soldier_move_attack3},
+	{"soldier_move_attack4", &soldier_move_attack4},
+	{"soldier_move_attack6", &soldier_move_attack6},
+	{"soldier_move_death1", &soldier_move_death1},
+	{"soldier_move_death2", &soldier_move_death2},
+	{"soldier_move_death3", &soldier_move_death3},
+	{"soldier_move_death4", &soldier_move_death4},
+	{"soldier_move_death5", &soldier_move_death5},
+	{"soldier_move_death6", &soldier_move_death6},
+	{"soldier_move_pain1", &soldier_move_pain1},
+	{"soldier_move_pain2", &soldier_move_pain2},
+	{"soldier_move_pain3", &soldier_move_pain3},
+	{"soldier_move_pain4", &soldier_move_pain4},
+	{"soldier_move_run", &soldier_move_run},
+	{"soldier_move_stand1", &soldier_move_stand1},
+	{"soldier_move_stand3", &soldier_move_stand3},
+	{"soldier_move_start_run", &soldier_move_start_run},
+	{"soldier_move_walk1", &soldier_move_walk1},
+	{"soldier_move_walk2", &soldier_move_walk2},
+}
+
+/*
+ * Helper function to get the human
+ * readable function definition by
+ * a function pointer. Returns an
+ * empty string for nil functions.
+ */
+func getFunctionByAddress(f interface{}) (string, error) {
+	v := reflect.ValueOf(f)
+	if v.IsNil() {
+		return "", nil
+	}
+
+	for _, fn := range functionList {
+		if reflect.ValueOf(fn.funcPtr).Pointer() == v.Pointer() {
+			return fn.funcStr, nil
+		}
+	}
+
+	return "", fmt.Errorf("function %v not in table, can't save game",
+		runtime.FuncForPC(v.Pointer()).Name())
+}
+
+/*
+ * Helper function to get a pointer to a
+ * function by it's human readable name.
+ */
+func findFunctionByName(name string) (interface{}, error) {
+	if len(name) == 0 {
+		return nil, nil
+	}
+
+	for _, fn := range functionList {
+		if fn.funcStr == name {
+			return fn.funcPtr, nil
+		}
+	}
+
+	return nil, fmt.Errorf("function %s not found in table, can't load game", name)
+}
+
+/*
+ * Helper function to get the human
+ * readable definition of a mmove_t
+ * struct by a pointer.
+ */
+func getMmoveByAddress(adr *mmove_t) (string, error) {
+	if adr == nil {
+		return "", nil
+	}
+
+	for _, m := range mmoveList {
+		if m.mmovePtr == adr {
+			return m.mmoveStr, nil
+		}
+	}
+
+	return "", fmt.Errorf("mmove not in table, can't save game")
+}
+
+/*
+ * Helper function to get a pointer to a
+ * mmove_t struct by a human readable definition.
+ */
+func findMmoveByName(name string) (*mmove_t, error) {
+	if len(name) == 0 {
+		return nil, nil
+	}
+
+	for _, m := range mmoveList {
+		if m.mmoveStr == name {
+			return m.mmovePtr, nil
+		}
+	}
+
+	return nil, fmt.Errorf("mmove %s not found in table, can't load game", name)
+}
+
+/* ========================================================= */
+
+/*
+ * The on-disk representation. Edicts are referenced
+ * by their index (-1 is nil), items by their classname
+ * and functions and mmoves by their name. Everything
+ * is written as JSON, so savegames can be inspected
+ * and diffed with standard tools.
+ */
+
+type savedPersistant struct {
+	Userinfo     string
+	Netname      string
+	Hand         int
+	Connected    bool
+	Health       int
+	MaxHealth    int
+	SavedFlags   int
+	SelectedItem int
+	Inventory    []int
+	MaxBullets   int
+	MaxShells    int
+	MaxRockets   int
+	MaxGrenades  int
+	MaxCells     int
+	MaxSlugs     int
+	Weapon       string
+	Lastweapon   string
+	Score        int
+	Spectator    bool
+}
+
+type savedRespawn struct {
+	CoopRespawn savedPersistant
+	Enterframe  int
+	Score       int
+	CmdAngles   [3]float32
+	Spectator   bool
+}
+
+type savedClient struct {
+	Ps             shared.Player_state_t
+	Pers           savedPersistant
+	Resp           savedRespawn
+	OldPmove       shared.Pmove_state_t
+	Showscores     bool
+	Showinventory  bool
+	Showhelp       bool
+	Showhelpicon   bool
+	AmmoIndex      int
+	Buttons        int
+	Oldbuttons     int
+	LatchedButtons int
+	WeaponThunk    bool
+	Newweapon      string
+	KillerYaw      float32
+	Weaponstate    int
+	KickAngles     [3]float32
+	KickOrigin     [3]float32
+	VDmgRoll       float32
+	VDmgPitch      float32
+	VDmgTime       float32
+	FallTime       float32
+	FallValue      float32
+	DamageAlpha    float32
+	BonusAlpha     float32
+	DamageBlend    [3]float32
+	VAngle         [3]float32
+	Bobtime        float32
+	Oldviewangles  [3]float32
+	Oldvelocity    [3]float32
+	AnimEnd        int
+	AnimPriority   int
+	PickupMsgTime  float32
+	ChaseTarget    int
+}
+
+type savedGame struct {
+	Version      string
+	Helpmessage1 string
+	Helpmessage2 string
+	Helpchanged  int
+	Spawnpoint   string
+	Maxclients   int
+	Maxentities  int
+	Serverflags  int
+	Autosaved    bool
+	Clients      []savedClient
+}
+
+type savedMoveinfo struct {
+	StartOrigin       [3]float32
+	StartAngles       [3]float32
+	EndOrigin         [3]float32
+	EndAngles         [3]float32
+	SoundStart        int
+	SoundMiddle       int
+	SoundEnd          int
+	Accel             float32
+	Speed             float32
+	Decel             float32
+	Distance          float32
+	Wait              float32
+	State             int
+	Dir               [3]float32
+	CurrentSpeed      float32
+	MoveSpeed         float32
+	NextSpeed         float32
+	RemainingDistance float32
+	DecelDistance     float32
+	Endfunc           string
+}
+
+type savedMonsterinfo struct {
+	Currentmove    string
+	Aiflags        int
+	Nextframe      int
+	Scale          float32
+	Stand          string
+	Idle           string
+	Search         string
+	Walk           string
+	Run            string
+	Attack         string
+	Melee          string
+	Sight          string
+	Checkattack    string
+	Pausetime      float32
+	AttackFinished float32
+	SearchTime     float32
+	TrailTime      float32
+	LastSighting   [3]float32
+	AttackState    int
+	IdleTime       float32
+	Linkcount      int
+}
+
+type savedEdict struct {
+	Index                 int
+	S                     shared.Entity_state_t
+	Client                bool
+	Inuse                 bool
+	Linkcount             int
+	Svflags               int
+	Mins                  [3]float32
+	Maxs                  [3]float32
+	Solid                 shared.Solid_t
+	Clipmask              int
+	Owner                 int
+	Movetype              int
+	Flags                 int
+	Model                 string
+	Freetime              float32
+	Message               string
+	Classname             string
+	Spawnflags            int
+	Timestamp             float32
+	Target                string
+	Targetname            string
+	Killtarget            string
+	Team                  string
+	Pathtarget            string
+	Deathtarget           string
+	Combattarget          string
+	Speed                 float32
+	Accel                 float32
+	Decel                 float32
+	Movedir               [3]float32
+	Pos1                  [3]float32
+	Pos2                  [3]float32
+	Velocity              [3]float32
+	Avelocity             [3]float32
+	Mass                  int
+	Gravity               float32
+	Goalentity            int
+	Movetarget            int
+	YawSpeed              float32
+	IdealYaw              float32
+	Nextthink             float32
+	Prethink              string
+	Think                 string
+	Touch                 string
+	Use                   string
+	Pain                  string
+	Die                   string
+	TouchDebounceTime     float32
+	PainDebounceTime      float32
+	DamageDebounceTime    float32
+	FlySoundDebounceTime  float32
+	LastMoveTime          float32
+	Health                int
+	MaxHealth             int
+	GibHealth             int
+	Deadflag              int
+	ShowHostile           float32
+	Map                   string
+	Viewheight            int
+	Takedamage            int
+	Dmg                   int
+	Sounds                int
+	Count                 int
+	Chain                 int
+	Enemy                 int
+	Oldenemy              int
+	Activator             int
+	Groundentity          int
+	GroundentityLinkcount int
+	Teamchain             int
+	Teammaster            int
+	Mynoise               int
+	Mynoise2              int
+	NoiseIndex            int
+	NoiseIndex2           int
+	Volume                float32
+	Attenuation           float32
+	Wait                  float32
+	Delay                 float32
+	Random                float32
+	Watertype             int
+	Waterlevel            int
+	Style                 int
+	Item                  string
+	Moveinfo              savedMoveinfo
+	Monsterinfo           savedMonsterinfo
+}
+
+type savedLevel struct {
+	Version              string
+	Framenum             int
+	Time                 float32
+	LevelName            string
+	Mapname              string
+	Nextmap              string
+	Intermissiontime     float32
+	SightClient          int
+	SightEntity          int
+	SightEntityFramenum  int
+	SoundEntity          int
+	SoundEntityFramenum  int
+	Sound2Entity         int
+	Sound2EntityFramenum int
+	PicHealth            int
+	TotalMonsters        int
+	KilledMonsters       int
+	Edicts               []savedEdict
+}
+
+/* ========================================================= */
+
+func edictIndex(ent *edict_t) int {
+	if ent == nil {
+		return -1
+	}
+	return ent.index
+}
+
+func (G *qGame) edictByIndex(index int) *edict_t {
+	if index < 0 || index >= len(G.g_edicts) {
+		return nil
+	}
+	return &G.g_edicts[index]
+}
+
+func itemClassname(item *gitem_t) string {
+	if item == nil {
+		return ""
+	}
+	return item.classname
+}
+
+func findItemByClassname(classname string) *gitem_t {
+	if len(classname) == 0 {
+		return nil
+	}
+
+	for i, it := range gameitemlist {
+		if it.classname == classname {
+			return &gameitemlist[i]
+		}
+	}
+
+	return nil
+}
+
+func writePersistant(pers *client_persistant_t) savedPersistant {
+	return savedPersistant{
+		Userinfo:     pers.userinfo,
+		Netname:      pers.netname,
+		Hand:         pers.hand,
+		Connected:    pers.connected,
+		Health:       pers.health,
+		MaxHealth:    pers.max_health,
+		SavedFlags:   pers.savedFlags,
+		SelectedItem: pers.selected_item,
+		Inventory:    append([]int{}, pers.inventory[:]...),
+		MaxBullets:   pers.max_bullets,
+		MaxShells:    pers.max_shells,
+		MaxRockets:   pers.max_rockets,
+		MaxGrenades:  pers.max_grenades,
+		MaxCells:     pers.max_cells,
+		MaxSlugs:     pers.max_slugs,
+		Weapon:       itemClassname(pers.weapon),
+		Lastweapon:   itemClassname(pers.lastweapon),
+		Score:        pers.score,
+		Spectator:    pers.spectator,
+	}
+}
+
+func readPersistant(s *savedPersistant, pers *client_persistant_t) {
+	pers.userinfo = s.Userinfo
+	pers.netname = s.Netname
+	pers.hand = s.Hand
+	pers.connected = s.Connected
+	pers.health = s.Health
+	pers.max_health = s.MaxHealth
+	pers.savedFlags = s.SavedFlags
+	pers.selected_item = s.SelectedItem
+	copy(pers.inventory[:], s.Inventory)
+	pers.max_bullets = s.MaxBullets
+	pers.max_shells = s.MaxShells
+	pers.max_rockets = s.MaxRockets
+	pers.max_grenades = s.MaxGrenades
+	pers.max_cells = s.MaxCells
+	pers.max_slugs = s.MaxSlugs
+	pers.weapon = findItemByClassname(s.Weapon)
+	pers.lastweapon = findItemByClassname(s.Lastweapon)
+	pers.score = s.Score
+	pers.spectator = s.Spectator
+}
+
+/*
+ * Writes a client_t
+ */
+func writeClient(client *gclient_t) savedClient {
+	return savedClient{
+		Ps:   client.ps,
+		Pers: writePersistant(&client.pers),
+		Resp: savedRespawn{
+			CoopRespawn: writePersistant(&client.resp.coop_respawn),
+			Enterframe:  client.resp.enterframe,
+			Score:       client.resp.score,
+			CmdAngles:   client.resp.cmd_angles,
+			Spectator:   client.resp.spectator,
+		},
+		OldPmove:       client.old_pmove,
+		Showscores:     client.showscores,
+		Showinventory:  client.showinventory,
+		Showhelp:       client.showhelp,
+		Showhelpicon:   client.showhelpicon,
+		AmmoIndex:      client.ammo_index,
+		Buttons:        client.buttons,
+		Oldbuttons:     client.oldbuttons,
+		LatchedButtons: client.latched_buttons,
+		WeaponThunk:    client.weapon_thunk,
+		Newweapon:      itemClassname(client.newweapon),
+		KillerYaw:      client.killer_yaw,
+		Weaponstate:    int(client.weaponstate),
+		KickAngles:     client.kick_angles,
+		KickOrigin:     client.kick_origin,
+		VDmgRoll:       client.v_dmg_roll,
+		VDmgPitch:      client.v_dmg_pitch,
+		VDmgTime:       client.v_dmg_time,
+		FallTime:       client.fall_time,
+		FallValue:      client.fall_value,
+		DamageAlpha:    client.damage_alpha,
+		BonusAlpha:     client.bonus_alpha,
+		DamageBlend:    client.damage_blend,
+		VAngle:         client.v_angle,
+		Bobtime:        client.bobtime,
+		Oldviewangles:  client.oldviewangles,
+		Oldvelocity:    client.oldvelocity,
+		AnimEnd:        client.anim_end,
+		AnimPriority:   client.anim_priority,
+		PickupMsgTime:  client.pickup_msg_time,
+		ChaseTarget:    edictIndex(client.chase_target),
+	}
+}
+
+/*
+ * Read the client structure. The chase target
+ * can only be resolved after the edicts are
+ * allocated, which is always the case when
+ * ReadGame is called.
+ */
+func (G *qGame) readClient(s *savedClient, client *gclient_t) {
+	client.copy(gclient_t{})
+	client.ps.Copy(s.Ps)
+	readPersistant(&s.Pers, &client.pers)
+	readPersistant(&s.Resp.CoopRespawn, &client.resp.coop_respawn)
+	client.resp.enterframe = s.Resp.Enterframe
+	client.resp.score = s.Resp.Score
+	client.resp.cmd_angles = s.Resp.CmdAngles
+	client.resp.spectator = s.Resp.Spectator
+	client.old_pmove.Copy(s.OldPmove)
+	client.showscores = s.Showscores
+	client.showinventory = s.Showinventory
+	client.showhelp = s.Showhelp
+	client.showhelpicon = s.Showhelpicon
+	client.ammo_index = s.AmmoIndex
+	client.buttons = s.Buttons
+	client.oldbuttons = s.Oldbuttons
+	client.latched_buttons = s.LatchedButtons
+	client.weapon_thunk = s.WeaponThunk
+	client.newweapon = findItemByClassname(s.Newweapon)
+	client.killer_yaw = s.KillerYaw
+	client.weaponstate = weaponstate_t(s.Weaponstate)
+	client.kick_angles = s.KickAngles
+	client.kick_origin = s.KickOrigin
+	client.v_dmg_roll = s.VDmgRoll
+	client.v_dmg_pitch = s.VDmgPitch
+	client.v_dmg_time = s.VDmgTime
+	client.fall_time = s.FallTime
+	client.fall_value = s.FallValue
+	client.damage_alpha = s.DamageAlpha
+	client.bonus_alpha = s.BonusAlpha
+	client.damage_blend = s.DamageBlend
+	client.v_angle = s.VAngle
+	client.bobtime = s.Bobtime
+	client.oldviewangles = s.Oldviewangles
+	client.oldvelocity = s.Oldvelocity
+	client.anim_end = s.AnimEnd
+	client.anim_priority = s.AnimPriority
+	client.pickup_msg_time = s.PickupMsgTime
+	client.chase_target = G.edictByIndex(s.ChaseTarget)
+}
+
+/*
+ * Writes the game struct into
+ * a file. This is called when
+ * ever the games goes to e new
+ * level or the user saves the
+ * game. Saved informations are:
+ * - cross level data
+ * - client states
+ * - help computer info
+ */
+func (G *qGame) WriteGame(filename string, autosave bool) error {
+
+	if !autosave {
+		G.saveClientData()
+	}
+
+	s := savedGame{
+		Version:      SAVEGAMEVER,
+		Helpmessage1: G.game.helpmessage1,
+		Helpmessage2: G.game.helpmessage2,
+		Helpchanged:  G.game.helpchanged,
+		Spawnpoint:   G.game.spawnpoint,
+		Maxclients:   G.game.maxclients,
+		Maxentities:  G.game.maxentities,
+		Serverflags:  G.game.serverflags,
+		Autosaved:    autosave,
+	}
+
+	for i := range G.game.clients {
+		s.Clients = append(s.Clients, writeClient(&G.game.clients[i]))
+	}
+
+	bfr, err := json.MarshalIndent(&s, "", "\t")
+	if err != nil {
+		return G.gi.Error("WriteGame: %v", err)
+	}
+
+	if err := os.WriteFile(filename, bfr, 0644); err != nil {
+		return G.gi.Error("Couldn't open %s", filename)
+	}
+
+	return nil
+}
+
+/*
+ * Read the game structs from
+ * a file. Called when ever a
+ * savegames is loaded.
+ */
+func (G *qGame) ReadGame(filename string) error {
+
+	bfr, err := os.ReadFile(filename)
+	if err != nil {
+		return G.gi.Error("Couldn't open %s", filename)
+	}
+
+	s := savedGame{}
+	if err := json.Unmarshal(bfr, &s); err != nil {
+		return G.gi.Error("ReadGame: %v", err)
+	}
+
+	/* Sanity checks */
+	if s.Version != SAVEGAMEVER {
+		return G.gi.Error("Savegame from an incompatible version.\n")
+	}
+
+	G.game.helpmessage1 = s.Helpmessage1
+	G.game.helpmessage2 = s.Helpmessage2
+	G.game.helpchanged = s.Helpchanged
+	G.game.spawnpoint = s.Spawnpoint
+	G.game.maxclients = s.Maxclients
+	G.game.maxentities = s.Maxentities
+	G.game.serverflags = s.Serverflags
+	G.game.autosaved = s.Autosaved
+
+	G.g_edicts = make([]edict_t, G.game.maxentities)
+	for i := range G.g_edicts {
+		G.g_edicts[i].index = i
+		G.g_edicts[i].area.Self = &G.g_edicts[i]
+	}
+
+	G.game.clients = make([]gclient_t, G.game.maxclients)
+	for i := 0; i < G.game.maxclients && i < len(s.Clients); i++ {
+		G.readClient(&s.Clients[i], &G.game.clients[i])
+	}
+
+	return nil
+}
+
+/* ========================================================== */
+
+/*
+ * Helper function to write the
+ * edict into a file.
+ */
+func writeEdict(ent *edict_t) (savedEdict, error) {
+	var err error
+	s := savedEdict{
+		Index:                 ent.index,
+		S:                     ent.s,
+		Client:                ent.client != nil,
+		Inuse:                 ent.inuse,
+		Linkcount:             ent.linkcount,
+		Svflags:               ent.svflags,
+		Mins:                  ent.mins,
+		Maxs:                  ent.maxs,
+		Solid:                 ent.solid,
+		Clipmask:              ent.clipmask,
+		Owner:                 edictIndex(ent.owner),
+		Movetype:              int(ent.movetype),
+		Flags:                 ent.flags,
+		Model:                 ent.Model,
+		Freetime:              ent.freetime,
+		Message:               ent.Message,
+		Classname:             ent.Classname,
+		Spawnflags:            ent.Spawnflags,
+		Timestamp:             ent.ftimestamp,
+		Target:                ent.Target,
+		Targetname:            ent.Targetname,
+		Killtarget:            ent.Killtarget,
+		Team:                  ent.Team,
+		Pathtarget:            ent.Pathtarget,
+		Deathtarget:           ent.Deathtarget,
+		Combattarget:          ent.Combattarget,
+		Speed:                 ent.Speed,
+		Accel:                 ent.Accel,
+		Decel:                 ent.Decel,
+		Movedir:               ent.movedir,
+		Pos1:                  ent.pos1,
+		Pos2:                  ent.pos2,
+		Velocity:              ent.velocity,
+		Avelocity:             ent.avelocity,
+		Mass:                  ent.Mass,
+		Gravity:               ent.gravity,
+		Goalentity:            edictIndex(ent.goalentity),
+		Movetarget:            edictIndex(ent.movetarget),
+		YawSpeed:              ent.yaw_speed,
+		IdealYaw:              ent.ideal_yaw,
+		Nextthink:             ent.nextthink,
+		TouchDebounceTime:     ent.touch_debounce_time,
+		PainDebounceTime:      ent.pain_debounce_time,
+		DamageDebounceTime:    ent.damage_debounce_time,
+		FlySoundDebounceTime:  ent.fly_sound_debounce_time,
+		LastMoveTime:          ent.last_move_time,
+		Health:                ent.Health,
+		MaxHealth:             ent.max_health,
+		GibHealth:             ent.gib_health,
+		Deadflag:              ent.deadflag,
+		ShowHostile:           ent.show_hostile,
+		Map:                   ent.Map,
+		Viewheight:            ent.viewheight,
+		Takedamage:            ent.takedamage,
+		Dmg:                   ent.Dmg,
+		Sounds:                ent.Sounds,
+		Count:                 ent.count,
+		Chain:                 edictIndex(ent.chain),
+		Enemy:                 edictIndex(ent.enemy),
+		Oldenemy:              edictIndex(ent.oldenemy),
+		Activator:             edictIndex(ent.activator),
+		Groundentity:          edictIndex(ent.groundentity),
+		GroundentityLinkcount: ent.groundentity_linkcount,
+		Teamchain:             edictIndex(ent.teamchain),
+		Teammaster:            edictIndex(ent.teammaster),
+		Mynoise:               edictIndex(ent.mynoise),
+		Mynoise2:              edictIndex(ent.mynoise2),
+		NoiseIndex:            ent.noise_index,
+		NoiseIndex2:           ent.noise_index2,
+		Volume:                ent.Volume,
+		Attenuation:           ent.Attenuation,
+		Wait:                  ent.Wait,
+		Delay:                 ent.Delay,
+		Random:                ent.Random,
+		Watertype:             ent.watertype,
+		Waterlevel:            ent.waterlevel,
+		Style:                 ent.Style,
+		Item:                  itemClassname(ent.item),
+	}
+
+	funcs := []struct {
+		dst *string
+		f   interface{}
+	}{
+		{&s.Prethink, ent.prethink},
+		{&s.Think, ent.think},
+		{&s.Touch, ent.touch},
+		{&s.Use, ent.use},
+		{&s.Pain, ent.pain},
+		{&s.Die, ent.die},
+		{&s.Moveinfo.Endfunc, ent.moveinfo.endfunc},
+		{&s.Monsterinfo.Stand, ent.monsterinfo.stand},
+		{&s.Monsterinfo.Idle, ent.monsterinfo.idle},
+		{&s.Monsterinfo.Search, ent.monsterinfo.search},
+		{&s.Monsterinfo.Walk, ent.monsterinfo.walk},
+		{&s.Monsterinfo.Run, ent.monsterinfo.run},
+		{&s.Monsterinfo.Attack, ent.monsterinfo.attack},
+		{&s.Monsterinfo.Melee, ent.monsterinfo.melee},
+		{&s.Monsterinfo.Sight, ent.monsterinfo.sight},
+		{&s.Monsterinfo.Checkattack, ent.monsterinfo.checkattack},
+	}
+	for _, f := range funcs {
+		if *f.dst, err = getFunctionByAddress(f.f); err != nil {
+			return s, err
+		}
+	}
+
+	m := &ent.moveinfo
+	s.Moveinfo.StartOrigin = m.start_origin
+	s.Moveinfo.StartAngles = m.start_angles
+	s.Moveinfo.EndOrigin = m.end_origin
+	s.Moveinfo.EndAngles = m.end_angles
+	s.Moveinfo.SoundStart = m.sound_start
+	s.Moveinfo.SoundMiddle = m.sound_middle
+	s.Moveinfo.SoundEnd = m.sound_end
+	s.Moveinfo.Accel = m.accel
+	s.Moveinfo.Speed = m.speed
+	s.Moveinfo.Decel = m.decel
+	s.Moveinfo.Distance = m.distance
+	s.Moveinfo.Wait = m.wait
+	s.Moveinfo.State = m.state
+	s.Moveinfo.Dir = m.dir
+	s.Moveinfo.CurrentSpeed = m.current_speed
+	s.Moveinfo.MoveSpeed = m.move_speed
+	s.Moveinfo.NextSpeed = m.next_speed
+	s.Moveinfo.RemainingDistance = m.remaining_distance
+	s.Moveinfo.DecelDistance = m.decel_distance
+
+	mi := &ent.monsterinfo
+	if s.Monsterinfo.Currentmove, err = getMmoveByAddress(mi.currentmove); err != nil {
+		return s, err
+	}
+	s.Monsterinfo.Aiflags = mi.aiflags
+	s.Monsterinfo.Nextframe = mi.nextframe
+	s.Monsterinfo.Scale = mi.scale
+	s.Monsterinfo.Pausetime = mi.pausetime
+	s.Monsterinfo.AttackFinished = mi.attack_finished
+	s.Monsterinfo.SearchTime = mi.search_time
+	s.Monsterinfo.TrailTime = mi.trail_time
+	s.Monsterinfo.LastSighting = mi.last_sighting
+	s.Monsterinfo.AttackState = mi.attack_state
+	s.Monsterinfo.IdleTime = mi.idle_time
+	s.Monsterinfo.Linkcount = mi.linkcount
+
+	return s, nil
+}
+
+/*
+ * Helper function to read
+ * the edict back into memory.
+ */
+func (G *qGame) readEdict(s *savedEdict, ent *edict_t) error {
+	ent.s.Copy(s.S)
+	ent.inuse = s.Inuse
+	ent.linkcount = s.Linkcount
+	ent.svflags = s.Svflags
+	ent.mins = s.Mins
+	ent.maxs = s.Maxs
+	ent.solid = s.Solid
+	ent.clipmask = s.Clipmask
+	ent.owner = G.edictByIndex(s.Owner)
+	ent.movetype = movetype_t(s.Movetype)
+	ent.flags = s.Flags
+	ent.Model = s.Model
+	ent.freetime = s.Freetime
+	ent.Message = s.Message
+	ent.Classname = s.Classname
+	ent.Spawnflags = s.Spawnflags
+	ent.ftimestamp = s.Timestamp
+	ent.Target = s.Target
+	ent.Targetname = s.Targetname
+	ent.Killtarget = s.Killtarget
+	ent.Team = s.Team
+	ent.Pathtarget = s.Pathtarget
+	ent.Deathtarget = s.Deathtarget
+	ent.Combattarget = s.Combattarget
+	ent.Speed = s.Speed
+	ent.Accel = s.Accel
+	ent.Decel = s.Decel
+	ent.movedir = s.Movedir
+	ent.pos1 = s.Pos1
+	ent.pos2 = s.Pos2
+	ent.velocity = s.Velocity
+	ent.avelocity = s.Avelocity
+	ent.Mass = s.Mass
+	ent.gravity = s.Gravity
+	ent.goalentity = G.edictByIndex(s.Goalentity)
+	ent.movetarget = G.edictByIndex(s.Movetarget)
+	ent.yaw_speed = s.YawSpeed
+	ent.ideal_yaw = s.IdealYaw
+	ent.nextthink = s.Nextthink
+	ent.touch_debounce_time = s.TouchDebounceTime
+	ent.pain_debounce_time = s.PainDebounceTime
+	ent.damage_debounce_time = s.DamageDebounceTime
+	ent.fly_sound_debounce_time = s.FlySoundDebounceTime
+	ent.last_move_time = s.LastMoveTime
+	ent.Health = s.Health
+	ent.max_health = s.MaxHealth
+	ent.gib_health = s.GibHealth
+	ent.deadflag = s.Deadflag
+	ent.show_hostile = s.ShowHostile
+	ent.Map = s.Map
+	ent.viewheight = s.Viewheight
+	ent.takedamage = s.Takedamage
+	ent.Dmg = s.Dmg
+	ent.Sounds = s.Sounds
+	ent.count = s.Count
+	ent.chain = G.edictByIndex(s.Chain)
+	ent.enemy = G.edictByIndex(s.Enemy)
+	ent.oldenemy = G.edictByIndex(s.Oldenemy)
+	ent.activator = G.edictByIndex(s.Activator)
+	ent.groundentity = G.edictByIndex(s.Groundentity)
+	ent.groundentity_linkcount = s.GroundentityLinkcount
+	ent.teamchain = G.edictByIndex(s.Teamchain)
+	ent.teammaster = G.edictByIndex(s.Teammaster)
+	ent.mynoise = G.edictByIndex(s.Mynoise)
+	ent.mynoise2 = G.edictByIndex(s.Mynoise2)
+	ent.noise_index = s.NoiseIndex
+	ent.noise_index2 = s.NoiseIndex2
+	ent.Volume = s.Volume
+	ent.Attenuation = s.Attenuation
+	ent.Wait = s.Wait
+	ent.Delay = s.Delay
+	ent.Random = s.Random
+	ent.watertype = s.Watertype
+	ent.waterlevel = s.Waterlevel
+	ent.Style = s.Style
+	ent.item = findItemByClassname(s.Item)
+
+	if s.Client && ent.index > 0 && ent.index <= len(G.game.clients) {
+		ent.client = &G.game.clients[ent.index-1]
+	}
+
+	m := &ent.moveinfo
+	m.start_origin = s.Moveinfo.StartOrigin
+	m.start_angles = s.Moveinfo.StartAngles
+	m.end_origin = s.Moveinfo.EndOrigin
+	m.end_angles = s.Moveinfo.EndAngles
+	m.sound_start = s.Moveinfo.SoundStart
+	m.sound_middle = s.Moveinfo.SoundMiddle
+	m.sound_end = s.Moveinfo.SoundEnd
+	m.accel = s.Moveinfo.Accel
+	m.speed = s.Moveinfo.Speed
+	m.decel = s.Moveinfo.Decel
+	m.distance = s.Moveinfo.Distance
+	m.wait = s.Moveinfo.Wait
+	m.state = s.Moveinfo.State
+	m.dir = s.Moveinfo.Dir
+	m.current_speed = s.Moveinfo.CurrentSpeed
+	m.move_speed = s.Moveinfo.MoveSpeed
+	m.next_speed = s.Moveinfo.NextSpeed
+	m.remaining_distance = s.Moveinfo.RemainingDistance
+	m.decel_distance = s.Moveinfo.DecelDistance
+
+	mi := &ent.monsterinfo
+	var err error
+	if mi.currentmove, err = findMmoveByName(s.Monsterinfo.Currentmove); err != nil {
+		return err
+	}
+	mi.aiflags = s.Monsterinfo.Aiflags
+	mi.nextframe = s.Monsterinfo.Nextframe
+	mi.scale = s.Monsterinfo.Scale
+	mi.pausetime = s.Monsterinfo.Pausetime
+	mi.attack_finished = s.Monsterinfo.AttackFinished
+	mi.search_time = s.Monsterinfo.SearchTime
+	mi.trail_time = s.Monsterinfo.TrailTime
+	mi.last_sighting = s.Monsterinfo.LastSighting
+	mi.attack_state = s.Monsterinfo.AttackState
+	mi.idle_time = s.Monsterinfo.IdleTime
+	mi.linkcount = s.Monsterinfo.Linkcount
+
+	/* self functions */
+	var f interface{}
+	for _, fn := range []struct {
+		field string
+		name  string
+		set   func(f interface{}) bool
+	}{
+		{"prethink", s.Prethink, func(f interface{}) (ok bool) {
+			ent.prethink, ok = f.(func(*edict_t, *qGame))
+			return
+		}},
+		{"think", s.Think, func(f interface{}) (ok bool) {
+			ent.think, ok = f.(func(*edict_t, *qGame))
+			return
+		}},
+		{"endfunc", s.Moveinfo.Endfunc, func(f interface{}) (ok bool) {
+			m.endfunc, ok = f.(func(*edict_t, *qGame))
+			return
+		}},
+		{"stand", s.Monsterinfo.Stand, func(f interface{}) (ok bool) {
+			mi.stand, ok = f.(func(*edict_t, *qGame))
+			return
+		}},
+		{"idle", s.Monsterinfo.Idle, func(f interface{}) (ok bool) {
+			mi.idle, ok = f.(func(*edict_t, *qGame))
+			return
+		}},
+		{"search", s.Monsterinfo.Search, func(f interface{}) (ok bool) {
+			mi.search, ok = f.(func(*edict_t, *qGame))
+			return
+		}},
+		{"walk", s.Monsterinfo.Walk, func(f interface{}) (ok bool) {
+			mi.walk, ok = f.(func(*edict_t, *qGame))
+			return
+		}},
+		{"run", s.Monsterinfo.Run, func(f interface{}) (ok bool) {
+			mi.run, ok = f.(func(*edict_t, *qGame))
+			return
+		}},
+		{"attack", s.Monsterinfo.Attack, func(f interface{}) (ok bool) {
+			mi.attack, ok = f.(func(*edict_t, *qGame))
+			return
+		}},
+		{"melee", s.Monsterinfo.Melee, func(f interface{}) (ok bool) {
+			mi.melee, ok = f.(func(*edict_t, *qGame))
+			return
+		}},
+		{"sight", s.Monsterinfo.Sight, func(f interface{}) (ok bool) {
+			mi.sight, ok = f.(func(*edict_t, *edict_t, *qGame))
+			return
+		}},
+		{"checkattack", s.Monsterinfo.Checkattack, func(f interface{}) (ok bool) {
+			mi.checkattack, ok = f.(func(*edict_t, *qGame) bool)
+			return
+		}},
+		{"touch", s.Touch, func(f interface{}) (ok bool) {
+			ent.touch, ok = f.(func(*edict_t, *edict_t, *shared.Cplane_t, *shared.Csurface_t, *qGame))
+			return
+		}},
+		{"use", s.Use, func(f interface{}) (ok bool) {
+			ent.use, ok = f.(func(*edict_t, *edict_t, *edict_t, *qGame))
+			return
+		}},
+		{"pain", s.Pain, func(f interface{}) (ok bool) {
+			ent.pain, ok = f.(func(*edict_t, *edict_t, float32, int, *qGame))
+			return
+		}},
+		{"die", s.Die, func(f interface{}) (ok bool) {
+			ent.die, ok = f.(func(*edict_t, *edict_t, *edict_t, int, []float32, *qGame))
+			return
+		}},
+	} {
+		if f, err = findFunctionByName(fn.name); err != nil {
+			return err
+		}
+		/* a function of the wrong type would
+		   silently become nil */
+		if !fn.set(f) && (f != nil) {
+			return fmt.Errorf("function %s can't be used as %s, can't load game",
+				fn.name, fn.field)
+		}
+	}
+
+	return nil
+}
+
+/*
+ * Writes the current level
+ * into a file.
+ */
+func (G *qGame) WriteLevel(filename string) error {
+
+	s := savedLevel{
+		Version:              SAVEGAMEVER,
+		Framenum:             G.level.framenum,
+		Time:                 G.level.time,
+		LevelName:            G.level.level_name,
+		Mapname:              G.level.mapname,
+		Nextmap:              G.level.nextmap,
+		Intermissiontime:     G.level.intermissiontime,
+		SightClient:          edictIndex(G.level.sight_client),
+		SightEntity:          edictIndex(G.level.sight_entity),
+		SightEntityFramenum:  G.level.sight_entity_framenum,
+		SoundEntity:          edictIndex(G.level.sound_entity),
+		SoundEntityFramenum:  G.level.sound_entity_framenum,
+		Sound2Entity:         edictIndex(G.level.sound2_entity),
+		Sound2EntityFramenum: G.level.sound2_entity_framenum,
+		PicHealth:            G.level.pic_health,
+		TotalMonsters:        G.level.total_monsters,
+		KilledMonsters:       G.level.killed_monsters,
+	}
+
+	/* write out all the entities */
+	for i := 0; i < G.num_edicts; i++ {
+		ent := &G.g_edicts[i]
+
+		if !ent.inuse {
+			continue
+		}
+
+		e, err := writeEdict(ent)
+		if err != nil {
+			return G.gi.Error("WriteLevel: %v", err)
+		}
+		s.Edicts = append(s.Edicts, e)
+	}
+
+	bfr, err := json.MarshalIndent(&s, "", "\t")
+	if err != nil {
+		return G.gi.Error("WriteLevel: %v", err)
+	}
+
+	if err := os.WriteFile(filename, bfr, 0644); err != nil {
+		return G.gi.Error("Couldn't open %s", filename)
+	}
+
+	return nil
+}
+
+/*
+ * Reads a level back into the memory.
+ * SpawnEntities were already called
+ * in the same way when the level was
+ * saved. All world links were cleared
+ * before this function was called. When
+ * this function is called, no clients
+ * are connected to the server.
+ */
+func (G *qGame) ReadLevel(filename string) error {
+
+	bfr, err := os.ReadFile(filename)
+	if err != nil {
+		return G.gi.Error("Couldn't open %s", filename)
+	}
+
+	s := savedLevel{}
+	if err := json.Unmarshal(bfr, &s); err != nil {
+		return G.gi.Error("ReadLevel: %v", err)
+	}
+
+	if s.Version != SAVEGAMEVER {
+		return G.gi.Error("Savegame from an incompatible version.\n")
+	}
+
+	/* wipe all the entities */
+	for i := range G.g_edicts {
+		G.g_edicts[i].copy(edict_t{})
+		G.g_edicts[i].index = i
+		G.g_edicts[i].area.Self = &G.g_edicts[i]
+	}
+
+	G.num_edicts = G.maxclients.Int() + 1
+
+	/* load the level locals */
+	G.level = level_locals_t{}
+	G.level.framenum = s.Framenum
+	G.level.time = s.Time
+	G.level.level_name = s.LevelName
+	G.level.mapname = s.Mapname
+	G.level.nextmap = s.Nextmap
+	G.level.intermissiontime = s.Intermissiontime
+	G.level.sight_client = G.edictByIndex(s.SightClient)
+	G.level.sight_entity = G.edictByIndex(s.SightEntity)
+	G.level.sight_entity_framenum = s.SightEntityFramenum
+	G.level.sound_entity = G.edictByIndex(s.SoundEntity)
+	G.level.sound_entity_framenum = s.SoundEntityFramenum
+	G.level.sound2_entity = G.edictByIndex(s.Sound2Entity)
+	G.level.sound2_entity_framenum = s.Sound2EntityFramenum
+	G.level.pic_health = s.PicHealth
+	G.level.total_monsters = s.TotalMonsters
+	G.level.killed_monsters = s.KilledMonsters
+
+	/* load all the entities */
+	for i := range s.Edicts {
+		entnum := s.Edicts[i].Index
+		if entnum < 0 || entnum >= len(G.g_edicts) {
+			return G.gi.Error("ReadLevel: bad entnum %v", entnum)
+		}
+
+		if entnum >= G.num_edicts {
+			G.num_edicts = entnum + 1
+		}
+
+		ent := &G.g_edicts[entnum]
+		if err := G.readEdict(&s.Edicts[i], ent); err != nil {
+			return G.gi.Error("ReadLevel: %v", err)
+		}
+
+		/* let the server rebuild world links for this ent */
+		G.gi.Linkentity(ent)
+	}
+
+	/* mark all clients as unconnected */
+	for i := 0; i < G.maxclients.Int(); i++ {
+		ent := &G.g_edicts[i+1]
+		ent.client = &G.game.clients[i]
+		ent.client.pers.connected = false
+	}
+
+	/* do any load time things at this point */
+	for i := 0; i < G.num_edicts; i++ {
+		ent := &G.g_edicts[i]
+
+		if !ent.inuse {
+			continue
+		}
+
+		/* fire any cross-level triggers */
+		if ent.Classname == "target_crosslevel_target" {
+			ent.nextthink = G.level.time + ent.Delay
+		}
+	}
+
+	return nil
+}
@@ -2,7 +2,9 @@ package manager
 
 import (
 	"log"
+	"quake2srv/game"
 	"quake2srv/shared"
+	"strings"
 
 	"github.com/gorilla/websocket"
 )
@@ -48,6 +50,14 @@ func (cl *qWSClient) Transmit(data []byte) {
 }
 
 func (cl *qWSClient) Handler() {
+	// Same filter list the games check in ClientConnect
+	if game.AddressFiltered(cl.Addr()) {
+		log.Println("Rejected filtered address", cl.Addr())
+		cl.conn.WriteMessage(2, []byte("ERROR"))
+		cl.conn.Close()
+		return
+	}
+
 	for {
 		_, message, err := cl.conn.ReadMessage()
 		if err != nil {
@@ -88,6 +98,39 @@ func (cl *qWSClient) Handler() {
 					cl.game = nil
 				}
 
+			case "demo":
+				if len(args) != 2 {
+					log.Println("Invalid parameters for demo", len(args))
+					continue
+				}
+				if strings.Contains(args[1], "..") || strings.ContainsAny(args[1], "/\\") {
+					log.Println("Invalid demo name", args[1])
+					cl.conn.WriteMessage(2, []byte("ERROR"))
+					continue
+				}
+				demo := args[1]
+				if !strings.HasSuffix(demo, ".dm2") {
+					demo += ".dm2"
+				}
+				if !cl.queues.demoExists(demo) {
+					log.Println("Unknown demo", demo)
+					cl.conn.WriteMessage(2, []byte("ERROR"))
+					continue
+				}
+				status, game := cl.queues.demoQueue.addToQueue(cl, "", "+demomap", demo)
+				switch status {
+				case STATUS_QUEUED:
+					cl.conn.WriteMessage(2, []byte("QUEUED"))
+					cl.game = nil
+				case STATUS_INGAME:
+					cl.conn.WriteMessage(2, []byte("GAME"))
+					cl.state = clientInGame
+					cl.game = game
+				case STATUS_ERROR:
+					cl.conn.WriteMessage(2, []byte("ERROR"))
+					cl.game = nil
+				}
+
 			default:
 				log.Println("Unknown command", args[0])
 			}
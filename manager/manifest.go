@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"quake2srv/common"
+	"quake2srv/server"
+	"quake2srv/shared"
+	"strings"
+	"sync"
+)
+
+// One file a client needs to play a map
+type ManifestEntry struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+	Hash string `json:"sha256"`
+}
+
+var manifestCache = make(map[string][]ManifestEntry)
+var manifestMu sync.Mutex
+
+// Returns the files precached by a map, found by spawning the
+// map in a game without clients. The result is cached, a map
+// is only spawned once for each mod and game mode.
+func MapManifest(fs shared.QFileSystem, gamedir, mapname string, deathmatch bool) ([]ManifestEntry, error) {
+	gfs, err := fs.GameFilesystem(gamedir)
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := gfs.Stat("maps/" + mapname + ".bsp"); err != nil || info.IsDir() {
+		return nil, fmt.Errorf("map %s not found", mapname)
+	}
+
+	key := fmt.Sprintf("%s/%s/%v", gamedir, strings.ToLower(mapname), deathmatch)
+
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+
+	if m, ok := manifestCache[key]; ok {
+		return m, nil
+	}
+
+	dm := "0"
+	if deathmatch {
+		dm = "1"
+	}
+
+	// Spawn the map, but never run a frame
+	c := common.CreateQuekeCommon(fs)
+	s := server.CreateQServer(c)
+	c.SetServer(s)
+	params := gameParams(gamedir, "+set", "logfile", "0", "+set", "sv_savedir", "manifest",
+		"+set", "deathmatch", dm, "+set", "coop", "0", "+map", mapname)
+	if err := c.Init(params); err != nil {
+		return nil, err
+	}
+	// The map command is usually run by the first frame
+	if err := c.Cbuf_Execute(); err != nil {
+		return nil, err
+	}
+
+	files := s.Precache()
+	if files == nil {
+		return nil, fmt.Errorf("map %s couldn't be spawned", mapname)
+	}
+
+	manifest := make([]ManifestEntry, 0, len(files))
+	for _, name := range files {
+		bfr, err := gfs.LoadFile(name)
+		if err != nil || bfr == nil {
+			continue
+		}
+		sum := sha256.Sum256(bfr)
+		manifest = append(manifest, ManifestEntry{name, len(bfr), hex.EncodeToString(sum[:])})
+	}
+
+	manifestCache[key] = manifest
+	return manifest, nil
+}
@@ -3,26 +3,67 @@ package manager
 import (
 	"fmt"
 	"log"
+	"os"
 	"quake2srv/common"
+	"quake2srv/game"
 	"quake2srv/server"
 	"quake2srv/shared"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// The levels of a running game are kept in a directory of
+// it's own. The counter starts at 1 again after a restart,
+// the start time keeps the games from using the directories
+// of the last run.
+var gameCounter int32
+var runID = time.Now().Unix()
+
 type GameQueueHandler struct {
 	singleQueue     GameQueue
 	coopQueue       GameQueue
 	deathMatchQueue GameQueue
+	demoQueue       GameQueue
+	demoFs          shared.QFileSystem
 }
 
-func CreateGameQueueHandler(singleCount, coopCount, dmCount int, fs shared.QFileSystem) *GameQueueHandler {
+// The games of a queue may run a mod, e.g. "ctf" or "rogue".
+// An empty name runs baseq2.
+func CreateGameQueueHandler(singleCount, coopCount, dmCount int, fs shared.QFileSystem,
+	singleGame, coopGame, dmGame string) *GameQueueHandler {
 	q := &GameQueueHandler{}
-	q.singleQueue = createGameQueue(singleCount, 1, []string{"+set", "deathmatch", "0", "+set", "coop", "0", "+newgame"}, fs, true)
-	q.coopQueue = createGameQueue(coopCount, 8, []string{"+dedicated_start"}, fs, false)
-	q.deathMatchQueue = createGameQueue(dmCount, 8, []string{"+dedicated_start"}, fs, false)
+	game.LoadIPFilters(fs.Gamedir())
+	q.singleQueue = createGameQueue("single", singleCount, 1, gameParams(singleGame, "+set", "deathmatch", "0", "+set", "coop", "0", "+newgame"), fs, true)
+	q.coopQueue = createGameQueue("coop", coopCount, 8, gameParams(coopGame, "+dedicated_start"), fs, false)
+	q.deathMatchQueue = createGameQueue("dm", dmCount, 8, gameParams(dmGame, "+dedicated_start"), fs, false)
+	q.demoQueue = createGameQueue("demo", singleCount, 1, gameParams(singleGame, "+set", "deathmatch", "0", "+set", "coop", "0"), fs, false)
+	q.demoFs = fs
+	if gfs, err := fs.GameFilesystem(singleGame); err == nil {
+		q.demoFs = gfs
+	}
 	return q
 }
 
+// Checks that a demo requested in the lobby exists
+// in the search path of the demo games
+func (q *GameQueueHandler) demoExists(demo string) bool {
+	if strings.ContainsAny(demo, "*?[") {
+		return false
+	}
+	list, err := q.demoFs.ListFiles("demos/" + demo)
+	return err == nil && len(list) == 1
+}
+
+// Prepends the mod selection to the command line of a game
+func gameParams(gamedir string, params ...string) []string {
+	if len(gamedir) == 0 {
+		return params
+	}
+	return append([]string{"+set", "game", gamedir}, params...)
+}
+
 // PUBLIC API
 
 type QueueStatus int
@@ -44,12 +85,13 @@ type QGame interface {
 }
 
 type GameQueue interface {
-	addToQueue(cl GameQueueClient, skillLevel string) (QueueStatus, QGame)
+	addToQueue(cl GameQueueClient, skillLevel string, extra ...string) (QueueStatus, QGame)
 }
 
 // IMPLEMENTATIONS
 
 type qGame struct {
+	slot    int
 	players []GameQueueClient
 	common  shared.QCommon
 	srvr    shared.QServer
@@ -92,6 +134,7 @@ func (G *qGame) Disconnect(adr string) {
 // QUEUE
 
 type gameQueue struct {
+	name          string
 	maxGames      int
 	maxPlayers    int
 	games         []*qGame
@@ -103,8 +146,9 @@ type gameQueue struct {
 	mu            sync.Mutex
 }
 
-func createGameQueue(gCount, pCount int, params []string, fs shared.QFileSystem, sl bool) GameQueue {
+func createGameQueue(name string, gCount, pCount int, params []string, fs shared.QFileSystem, sl bool) GameQueue {
 	q := &gameQueue{}
+	q.name = name
 	q.maxGames = gCount
 	q.maxPlayers = pCount
 	q.games = make([]*qGame, 0)
@@ -116,7 +160,7 @@ func createGameQueue(gCount, pCount int, params []string, fs shared.QFileSystem,
 	return q
 }
 
-func (q *gameQueue) addToQueue(cl GameQueueClient, skillLevel string) (QueueStatus, QGame) {
+func (q *gameQueue) addToQueue(cl GameQueueClient, skillLevel string, extra ...string) (QueueStatus, QGame) {
 	println("addToQueue", len(q.queued), len(q.games))
 	q.mu.Lock()
 	if len(q.queued) > 0 {
@@ -136,6 +180,7 @@ func (q *gameQueue) addToQueue(cl GameQueueClient, skillLevel string) (QueueStat
 		return STATUS_QUEUED, nil
 	}
 	g := &qGame{}
+	g.slot = q.freeSlot()
 	g.players = make([]GameQueueClient, 1)
 	g.players[0] = cl
 	g.common = common.CreateQuekeCommon(q.fs)
@@ -143,7 +188,13 @@ func (q *gameQueue) addToQueue(cl GameQueueClient, skillLevel string) (QueueStat
 	g.common.SetServer(g.srvr)
 	q.games = append(q.games, g)
 	q.mu.Unlock()
-	params := q.params
+	params := append([]string{}, q.params...)
+	params = append(params, "+set")
+	params = append(params, "sv_savedir")
+	params = append(params, fmt.Sprintf("%s%v", q.name, g.slot))
+	params = append(params, "+set")
+	params = append(params, "sv_currentdir")
+	params = append(params, fmt.Sprintf("current%v-%v", runID, atomic.AddInt32(&gameCounter, 1)))
 	params = append(params, "+set")
 	params = append(params, "maxclients")
 	params = append(params, fmt.Sprintf("%v", q.maxPlayers))
@@ -152,6 +203,7 @@ func (q *gameQueue) addToQueue(cl GameQueueClient, skillLevel string) (QueueStat
 		params = append(params, "skill")
 		params = append(params, skillLevel)
 	}
+	params = append(params, extra...)
 	g.common.Init(params)
 	g.common.RegisterClient(cl.Addr(), txHandler, cl)
 	go runGame(g, q)
@@ -166,6 +218,7 @@ func txHandler(data []byte, a interface{}) {
 func runGame(G *qGame, q *gameQueue) {
 	G.common.MainLoop()
 	log.Println("GAME EXIT")
+	removeCurrentdir(G)
 	q.mu.Lock()
 	index := -1
 	for i, g := range q.games {
@@ -191,3 +244,35 @@ func runGame(G *qGame, q *gameQueue) {
 	q.mu.Unlock()
 
 }
+
+// Each game runs in a slot of its queue, the saves of
+// the slot are kept for the next game running in it.
+// The caller holds the lock of the queue.
+func (q *gameQueue) freeSlot() int {
+	for slot := 1; ; slot++ {
+		used := false
+		for _, g := range q.games {
+			if g.slot == slot {
+				used = true
+				break
+			}
+		}
+		if !used {
+			return slot
+		}
+	}
+}
+
+// The levels of a game that ended can't be
+// entered again, remove them. The saves and
+// the log of the game are kept.
+func removeCurrentdir(G *qGame) {
+	currentdir := G.common.Cvar_VariableString("sv_currentdir")
+	if len(currentdir) == 0 {
+		return
+	}
+	dir := fmt.Sprintf("%s/save/%s", G.common.FS_Gamedir(), currentdir)
+	if err := os.RemoveAll(dir); err != nil {
+		log.Printf("Couldn't remove %s: %v\n", dir, err)
+	}
+}
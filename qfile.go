@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"image/png"
+	"io/fs"
+	"net/http"
+	"path"
+	"quake2srv/shared"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * Files with these extensions are worth compressing,
+ * archives and already compressed formats aren't.
+ */
+var qfileCompressible = map[string]bool{
+	".bsp": true, ".md2": true, ".sp2": true, ".wal": true,
+	".pcx": true, ".tga": true, ".wav": true, ".dm2": true,
+	".lst": true,
+}
+
+/*
+ * A file as it's sent to the clients. The
+ * compressed variant is only kept if it's
+ * smaller than the file.
+ */
+type qfileEntry struct {
+	key     string
+	data    []byte
+	gz      []byte
+	etag    string
+	modtime time.Time
+}
+
+func (e *qfileEntry) size() int {
+	return len(e.data) + len(e.gz)
+}
+
+/*
+ * Keeps the most recently requested files in
+ * memory, up to max bytes. An entry is only
+ * used as long as the modification time of
+ * the file didn't change.
+ */
+type qfileCache struct {
+	max     int
+	size    int
+	lru     *list.List
+	entries map[string]*list.Element
+	mu      sync.Mutex
+}
+
+var qfiles *qfileCache
+
+func newQfileCache(max int) *qfileCache {
+	c := &qfileCache{}
+	c.max = max
+	c.lru = list.New()
+	c.entries = make(map[string]*list.Element)
+	return c
+}
+
+func (c *qfileCache) get(key string, modtime time.Time) *qfileEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+
+	e := el.Value.(*qfileEntry)
+	if !e.modtime.Equal(modtime) {
+		c.remove(el)
+		return nil
+	}
+
+	c.lru.MoveToFront(el)
+	return e
+}
+
+/*
+ * A few huge files would push
+ * out everything else.
+ */
+func (c *qfileCache) fits(size int) bool {
+	return size <= c.max/8
+}
+
+func (c *qfileCache) add(e *qfileEntry) {
+	if !c.fits(e.size()) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[e.key]; ok {
+		c.remove(el)
+	}
+
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.size += e.size()
+
+	for c.size > c.max {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *qfileCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*qfileEntry)
+	delete(c.entries, e.key)
+	c.size -= e.size()
+}
+
+/*
+ * Names are relative to the search path,
+ * anything that could leave it is refused.
+ */
+func validQfileName(name string) bool {
+	if len(name) == 0 || strings.ContainsAny(name, "\\:") || strings.HasPrefix(name, "/") {
+		return false
+	}
+
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return false
+		}
+	}
+
+	return path.Clean(name) == name
+}
+
+func loadQfile(fsys shared.QFileSystem, name string, info fs.FileInfo) (*qfileEntry, error) {
+	key := fsys.Gamedir() + "/" + strings.ToLower(name)
+
+	if e := qfiles.get(key, info.ModTime()); e != nil {
+		return e, nil
+	}
+
+	bfr, err := fsys.LoadFile(name)
+	if err != nil {
+		return nil, err
+	} else if bfr == nil {
+		return nil, fs.ErrNotExist
+	}
+
+	e := newQfileEntry(key, bfr, info.ModTime(), qfileCompressible[strings.ToLower(path.Ext(name))])
+	qfiles.add(e)
+	return e, nil
+}
+
+/*
+ * Converts a .pcx pic or one mip level of a .wal
+ * texture to PNG, with the palette of
+ * pics/colormap.pcx like the renderer does.
+ */
+func loadQfilePNG(fsys shared.QFileSystem, name string, info fs.FileInfo, miplevel int) (*qfileEntry, error) {
+	key := fmt.Sprintf("%s/%s#png%d", fsys.Gamedir(), strings.ToLower(name), miplevel)
+
+	if e := qfiles.get(key, info.ModTime()); e != nil {
+		return e, nil
+	}
+
+	bfr, err := fsys.LoadFile(name)
+	if err != nil {
+		return nil, err
+	} else if bfr == nil {
+		return nil, fs.ErrNotExist
+	}
+
+	data, err := convertToPNG(fsys, bfr, path.Ext(name), miplevel)
+	if err != nil {
+		return nil, err
+	}
+
+	e := newQfileEntry(key, data, info.ModTime(), false)
+	qfiles.add(e)
+	return e, nil
+}
+
+func convertToPNG(fsys shared.QFileSystem, bfr []byte, ext string, miplevel int) ([]byte, error) {
+	cmap, err := fsys.LoadFile("pics/colormap.pcx")
+	if err != nil {
+		return nil, err
+	} else if cmap == nil {
+		return nil, fmt.Errorf("Couldn't load pics/colormap.pcx")
+	}
+
+	_, palette, _, _, err := shared.LoadPCX(cmap)
+	if err != nil {
+		return nil, err
+	}
+
+	var pix []byte
+	var width, height int
+	if strings.EqualFold(ext, ".wal") {
+		pix, width, height, err = shared.LoadWAL(bfr, miplevel)
+	} else {
+		pix, _, width, height, err = shared.LoadPCX(bfr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := png.Encode(&out, shared.PalettedImage(pix, palette, width, height)); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+/*
+ * Converts a .md2 model or a .sp2 sprite to
+ * binary glTF, with the skins or frames
+ * converted to PNG.
+ */
+func convertToGLB(fsys shared.QFileSystem, bfr []byte, ext string) ([]byte, error) {
+	sprite := strings.EqualFold(ext, ".sp2")
+
+	var names []string
+	var err error
+	if sprite {
+		names, err = shared.SP2Frames(bfr)
+	} else {
+		names, err = shared.MD2Skins(bfr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pics := make([][]byte, len(names))
+	for i, name := range names {
+		pic, _ := fsys.LoadFile(name)
+		if pic == nil || !strings.EqualFold(path.Ext(name), ".pcx") {
+			continue
+		}
+		pics[i], _ = convertToPNG(fsys, pic, ".pcx", 0)
+	}
+
+	if sprite {
+		return shared.SP2ToGLB(bfr, pics)
+	}
+	return shared.MD2ToGLB(bfr, pics)
+}
+
+func loadQfileGLB(fsys shared.QFileSystem, name string, info fs.FileInfo) (*qfileEntry, error) {
+	key := fsys.Gamedir() + "/" + strings.ToLower(name) + "#glb"
+
+	if e := qfiles.get(key, info.ModTime()); e != nil {
+		return e, nil
+	}
+
+	bfr, err := fsys.LoadFile(name)
+	if err != nil {
+		return nil, err
+	} else if bfr == nil {
+		return nil, fs.ErrNotExist
+	}
+
+	data, err := convertToGLB(fsys, bfr, path.Ext(name))
+	if err != nil {
+		return nil, err
+	}
+
+	e := newQfileEntry(key, data, info.ModTime(), true)
+	qfiles.add(e)
+	return e, nil
+}
+
+func newQfileEntry(key string, data []byte, modtime time.Time, compress bool) *qfileEntry {
+	e := &qfileEntry{}
+	e.key = key
+	e.data = data
+	e.modtime = modtime
+	e.etag = fmt.Sprintf("\"%x-%x\"", e.modtime.Unix(), sha1.Sum(data))
+
+	if compress {
+		/* files too big for the cache are compressed
+		   again for every request, keep that cheap */
+		level := gzip.BestCompression
+		if !qfiles.fits(len(data)) {
+			level = gzip.BestSpeed
+		}
+
+		var gz bytes.Buffer
+		zw, _ := gzip.NewWriterLevel(&gz, level)
+		zw.Write(data)
+		zw.Close()
+		if gz.Len() < len(data) {
+			e.gz = gz.Bytes()
+		}
+	}
+
+	return e
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		if i := strings.IndexByte(enc, ';'); i >= 0 {
+			if strings.TrimSpace(enc[i+1:]) == "q=0" {
+				continue
+			}
+			enc = enc[:i]
+		}
+		if strings.TrimSpace(enc) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * Serves a file from the search path. Conditional
+ * and range requests are handled by ServeContent,
+ * compressible files are sent gzipped to clients
+ * that accept it, unless a range was requested.
+ * Pics and textures are converted to PNG with
+ * ?format=png, ?mip=1..3 selects a smaller mip
+ * level of a texture. Models and sprites are
+ * converted to binary glTF with ?format=gltf.
+ */
+func qfile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	if !validQfileName(r.URL.Path[7:]) {
+		http.Error(w, "invalid file name", http.StatusBadRequest)
+		return
+	}
+
+	fsys, name := gameFilesystem(r.URL.Path[7:])
+	if !shared.IsAsset(name) {
+		http.NotFound(w, r)
+		return
+	}
+
+	info, err := fsys.Stat(name)
+	if err == nil && info.IsDir() {
+		err = fs.ErrNotExist
+	}
+
+	ext := strings.ToLower(path.Ext(name))
+	toPNG := r.URL.Query().Get("format") == "png"
+	toGLB := r.URL.Query().Get("format") == "gltf"
+	if toGLB && (ext != ".md2") && (ext != ".sp2") {
+		http.Error(w, "only .md2 and .sp2 can be converted", http.StatusBadRequest)
+		return
+	}
+	miplevel := 0
+	if toPNG {
+		if (ext != ".pcx") && (ext != ".wal") {
+			http.Error(w, "only .pcx and .wal can be converted", http.StatusBadRequest)
+			return
+		}
+		if m := r.URL.Query().Get("mip"); len(m) > 0 {
+			var perr error
+			if miplevel, perr = strconv.Atoi(m); (perr != nil) || (miplevel < 0) ||
+				(miplevel >= shared.MIPLEVELS) || (ext != ".wal") {
+				http.Error(w, "invalid mip level", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	var e *qfileEntry
+	if (err == nil) && toPNG {
+		e, err = loadQfilePNG(fsys, name, info, miplevel)
+	} else if (err == nil) && toGLB {
+		e, err = loadQfileGLB(fsys, name, info)
+	} else if err == nil {
+		e, err = loadQfile(fsys, name, info)
+	}
+
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctype := shared.AssetTypes[ext]
+	if toPNG {
+		ctype = "image/png"
+	} else if toGLB {
+		ctype = "model/gltf-binary"
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+
+	content := e.data
+	etag := e.etag
+	if e.gz != nil {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if len(r.Header.Get("Range")) == 0 && acceptsGzip(r) {
+			w.Header().Set("Content-Encoding", "gzip")
+			content = e.gz
+			etag = strings.TrimSuffix(e.etag, "\"") + "-gz\""
+		}
+	}
+	w.Header().Set("ETag", etag)
+
+	http.ServeContent(w, r, name, e.modtime, bytes.NewReader(content))
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"quake2srv/manager"
 	"quake2srv/shared"
+	"sort"
+	"strings"
 
 	"github.com/gorilla/websocket"
 )
@@ -15,6 +19,10 @@ var addr = flag.String("addr", "localhost:8081", "http service address")
 var singleQueues = flag.Int("single", 5, "number of single player games")
 var coopQueues = flag.Int("coop", 5, "number of coop games")
 var dmQueues = flag.Int("dm", 5, "number of death match games")
+var singleGame = flag.String("singlegame", "", "mod directory of the single player games")
+var coopGame = flag.String("coopgame", "", "mod directory of the coop games")
+var dmGame = flag.String("dmgame", "", "mod directory of the death match games")
+var fileCacheSize = flag.Int("filecache", 64, "size of the cache for /qfile/ in MB")
 
 var filesystem shared.QFileSystem
 
@@ -43,19 +51,99 @@ func connect(w http.ResponseWriter, r *http.Request) {
 	go clientHandler(cl)
 }
 
-func qfile(w http.ResponseWriter, r *http.Request) {
-	path := r.URL.Path[7:]
+/*
+ * Files of a mod are requested below the
+ * mod directory, e.g. /qfile/ctf/maps/...
+ */
+func gameFilesystem(path string) (shared.QFileSystem, string) {
+	if i := strings.IndexByte(path, '/'); i > 0 {
+		if gfs, err := filesystem.GameFilesystem(path[:i]); err == nil {
+			return gfs, path[i+1:]
+		}
+	}
+	return filesystem, path
+}
+
+type qindexEntry struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+/*
+ * Lists the files that can be fetched through
+ * /qfile/ as JSON. Without a pattern all files
+ * are listed, otherwise only those matching one
+ * of the patterns, e.g. /qindex/?pattern=maps/*.bsp
+ * or /qindex/ctf/?pattern=pics/*.pcx for a mod.
+ */
+func qindex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+
+	fsys, _ := gameFilesystem(r.URL.Path[8:])
+
+	var names []string
+	if patterns, ok := r.URL.Query()["pattern"]; ok {
+		for _, p := range patterns {
+			list, err := fsys.ListFiles(p)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			names = append(names, list...)
+		}
+		sort.Strings(names)
+	} else {
+		fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				names = append(names, name)
+			}
+			return nil
+		})
+	}
+
+	index := make([]qindexEntry, 0, len(names))
+	for i, name := range names {
+		/* assets are always in a subdirectory,
+		   this leaves out the paks themselves */
+		if (i > 0 && names[i-1] == name) || !strings.Contains(name, "/") || !shared.IsAsset(name) {
+			continue
+		}
+		info, err := fsys.Stat(name)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		index = append(index, qindexEntry{name, info.Size()})
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(index)
+}
+
+/*
+ * Lists the files a map precaches with their
+ * sizes and hashes as JSON, so a client can
+ * fetch them before joining. /qmanifest/base1
+ * for baseq2, /qmanifest/ctf/q2ctf1 for a mod,
+ * ?deathmatch=1 for the items of a dm game.
+ */
+func qmanifest(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Access-Control-Allow-Origin", "*")
-	w.Header().Add("Content-Type", "application/octet-stream")
 
-	bfr, err := filesystem.LoadFile(path)
+	gamedir, mapname := "", r.URL.Path[11:]
+	if i := strings.IndexByte(mapname, '/'); i >= 0 {
+		gamedir, mapname = mapname[:i], mapname[i+1:]
+	}
+	deathmatch := r.URL.Query().Get("deathmatch") == "1"
+
+	manifest, err := manager.MapManifest(filesystem, gamedir, mapname, deathmatch)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-	} else if bfr == nil {
+		log.Println("qmanifest:", err)
 		w.WriteHeader(http.StatusNotFound)
-	} else {
-		w.Write(bfr)
+		return
 	}
+
+	w.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manifest)
 }
 
 func main() {
@@ -63,12 +151,23 @@ func main() {
 
 	dir, _ := os.UserHomeDir()
 	filesystem = shared.InitFilesystem(dir, false)
+	/* only the mods of the games can be used,
+	   also for /qfile/ and /qindex/ */
+	filesystem.AllowGames(*singleGame, *coopGame, *dmGame)
+
+	if flag.NArg() > 0 {
+		os.Exit(runTool(flag.Args()))
+	}
 
-	queueHandler = *manager.CreateGameQueueHandler(*singleQueues, *coopQueues, *dmQueues, filesystem)
+	queueHandler = *manager.CreateGameQueueHandler(*singleQueues, *coopQueues, *dmQueues, filesystem,
+		*singleGame, *coopGame, *dmGame)
 
 	http.HandleFunc("/ping", pong)
 	http.HandleFunc("/connect", connect)
+	qfiles = newQfileCache(*fileCacheSize << 20)
 	http.HandleFunc("/qfile/", qfile)
+	http.HandleFunc("/qindex/", qindex)
+	http.HandleFunc("/qmanifest/", qmanifest)
 	println("Starting to listen...")
 	log.Fatal(http.ListenAndServe(*addr, nil))
 }
@@ -25,7 +25,11 @@
  */
 package server
 
-import "quake2srv/shared"
+import (
+	"bytes"
+	"os"
+	"quake2srv/shared"
+)
 
 /* MAX_CHALLENGES is made large to prevent a denial
    of service attack that could cycle all of them
@@ -63,7 +67,7 @@ type server_t struct {
 	multicast *shared.QWritebuf
 
 	/* demo server information */
-	// demofile shared.QFileHandle
+	demofile *bytes.Reader
 	// qboolean timedemo; /* don't time sync */
 }
 
@@ -86,6 +90,17 @@ type client_frame_t struct {
 	senttime     int /* for ping calculations */
 }
 
+const (
+	LATENCY_COUNTS = 16
+	RATE_MESSAGES  = 10
+
+	MAX_USERCMD_MSEC  = 250   /* clients never send longer moves */
+	MAX_USERCMD_MOVE  = 400   /* cl_forwardspeed * 2 when running */
+	MAX_USERCMD_PITCH = 16202 /* ANGLE2SHORT(89), the limit of Pmove */
+
+	SV_OUTPUTBUF_LENGTH = shared.MAX_MSGLEN - 16
+)
+
 type client_t struct {
 	index int
 	state client_state_t
@@ -98,16 +113,18 @@ type client_t struct {
 
 	commandMsec int /* every seconds this is reset, if user */
 	/* commands exhaust it, assume time cheating */
+	commandMsecViolations int /* budgets exhausted in a row */
 
-	// int frame_latency[LATENCY_COUNTS];
-	ping int
+	frame_latency [LATENCY_COUNTS]int
+	ping          int
 
-	// int message_size[RATE_MESSAGES];    /* used to rate drop packets */
+	message_size  [RATE_MESSAGES]int /* used to rate drop packets */
 	rate          int
 	surpressCount int /* number of messages rate supressed */
 
 	edict        shared.Edict_s /* EDICT_NUM(clientnum+1) */
 	name         string         /* extracted from userinfo, high bits masked */
+	namechanged  int            /* svs.realtime of the last name change */
 	messagelevel int            /* for filtering printed messages */
 
 	/* The datagram is written to by sound calls, prints,
@@ -118,6 +135,10 @@ type client_t struct {
 
 	frames [shared.UPDATE_BACKUP]client_frame_t /* updates can be delta'd from here */
 
+	download      []byte /* file being downloaded */
+	downloadsize  int    /* total bytes (can't use EOF because of paks) */
+	downloadcount int    /* bytes sent */
+
 	lastmessage int /* sv.framenum when packet was last received */
 	lastconnect int
 
@@ -150,10 +171,9 @@ type server_static_t struct {
 
 	challenges [MAX_CHALLENGES]challenge_t /* to prevent invalid IPs from connecting */
 
-	// /* serverrecord values */
-	// FILE *demofile;
-	// sizebuf_t demo_multicast;
-	// byte demo_multicast_buf[MAX_MSGLEN];
+	/* serverrecord values */
+	demofile       *os.File
+	demo_multicast *shared.QWritebuf
 }
 
 type qServer struct {
@@ -162,6 +182,8 @@ type qServer struct {
 	sv_paused              *shared.CvarT
 	sv_timedemo            *shared.CvarT
 	sv_enforcetime         *shared.CvarT
+	sv_enforcetime_slop    *shared.CvarT /* msec allowed above the budget */
+	sv_enforcetime_kick    *shared.CvarT /* kick after that many violations */
 	timeout                *shared.CvarT /* seconds without any message */
 	zombietime             *shared.CvarT /* seconds to sink messages after disconnect */
 	rcon_password          *shared.CvarT /* password for remote server commands */
@@ -170,6 +192,7 @@ type qServer struct {
 	allow_download_models  *shared.CvarT
 	allow_download_sounds  *shared.CvarT
 	allow_download_maps    *shared.CvarT
+	allow_download_paks    *shared.CvarT /* serve files from protected paks */
 	sv_airaccelerate       *shared.CvarT
 	sv_noreload            *shared.CvarT /* don't reload level state when reentering */
 	maxclients             *shared.CvarT /* rename sv_maxclients */
@@ -178,6 +201,10 @@ type qServer struct {
 	public_server          *shared.CvarT /* should heartbeats be sent */
 	sv_entfile             *shared.CvarT /* External entity files. */
 	sv_downloadserver      *shared.CvarT /* Download server. */
+	sv_savedir             *shared.CvarT /* Savegame directory of this game. */
+	sv_currentdir          *shared.CvarT /* Directory of the levels of this game. */
+	sv_autorecord          *shared.CvarT /* Record a demo of every level. */
+	sv_namechange_delay    *shared.CvarT /* Seconds between name changes. */
 
 	sv  server_t
 	svs server_static_t
@@ -197,6 +224,10 @@ type qServer struct {
 	area_type                 int
 
 	sv_player shared.Edict_s
+
+	cmd_args []string /* arguments of the command passed to the game */
+
+	game_error error /* raised by an import while the game was running */
 }
 
 func CreateQServer(common shared.QCommon) shared.QServer {
@@ -27,21 +27,28 @@
  */
 package server
 
-import "log"
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"quake2srv/shared"
+	"strings"
+)
 
 /*
  * Puts the server in demo mode on a specific map/cinematic
  */
-// func sv_DemoMap_f(args []string, arg interface{}) error {
+func sv_DemoMap_f(args []string, arg interface{}) error {
 
-// 	T := arg.(*qServer)
-// 	if len(args) != 2 {
-// 		log.Printf("USAGE: demomap <demoname.dm2>\n")
-// 		return nil
-// 	}
+	T := arg.(*qServer)
+	if len(args) != 2 {
+		T.common.Com_Printf("USAGE: demomap <demoname.dm2>\n")
+		return nil
+	}
 
-// 	return T.svMap(true, args[1], false)
-// }
+	return T.svMap(true, args[1], false)
+}
 
 /*
  * Saves the state of the map just being exited and goes to a new map.
@@ -57,58 +64,48 @@ import "log"
  * goes to map jail.bsp.
  */
 func sv_GameMap_f(args []string, arg interface{}) error {
-	//  char *map;
-	//  int i;
-	//  client_t *cl;
-	//  qboolean *savedInuse;
 	T := arg.(*qServer)
 
 	if len(args) != 2 {
-		log.Printf("USAGE: gamemap <map>\n")
+		T.common.Com_Printf("USAGE: gamemap <map>\n")
 		return nil
 	}
 
-	log.Printf("SV_GameMap(%s)\n", args[1])
+	T.common.Com_Printf("SV_GameMap(%s)\n", args[1])
 
-	//  FS_CreatePath(va("%s/save/current/", FS_Gamedir()));
+	os.MkdirAll(T.currentDir(), 0755)
 
 	/* check for clearing the current savegame */
 	mmap := args[1]
 
-	//  if (map[0] == '*')
-	//  {
-	// 	 /* wipe all the *.sav files */
-	// 	 SV_WipeSavegame("current");
-	//  }
-	//  else
-	//  {
-	// 	 /* save the map just exited */
-	// 	 if (sv.state == ss_game)
-	// 	 {
-	// 		 /* clear all the client inuse flags before saving so that
-	// 			when the level is re-entered, the clients will spawn
-	// 			at spawn points instead of occupying body shells */
-	// 		 savedInuse = malloc(maxclients->value * sizeof(qboolean));
-
-	// 		 YQ2_COM_CHECK_OOM(savedInuse, "malloc()", maxclients->value * sizeof(qboolean))
-
-	// 		 for (i = 0, cl = svs.clients; i < maxclients->value; i++, cl++)
-	// 		 {
-	// 			 savedInuse[i] = cl->edict->inuse;
-	// 			 cl->edict->inuse = false;
-	// 		 }
-
-	// 		 SV_WriteLevelFile();
-
-	// 		 /* we must restore these for clients to transfer over correctly */
-	// 		 for (i = 0, cl = svs.clients; i < maxclients->value; i++, cl++)
-	// 		 {
-	// 			 cl->edict->inuse = savedInuse[i];
-	// 		 }
-
-	// 		 free(savedInuse);
-	// 	 }
-	//  }
+	if strings.HasPrefix(mmap, "*") {
+		/* wipe all the *.sav files */
+		T.wipeSavegame("current")
+	} else {
+		/* save the map just exited */
+		if T.sv.state == ss_game {
+			/* clear all the client inuse flags before saving so that
+			when the level is re-entered, the clients will spawn
+			at spawn points instead of occupying body shells */
+			savedInuse := make([]bool, len(T.svs.clients))
+
+			for i, cl := range T.svs.clients {
+				savedInuse[i] = cl.edict.Inuse()
+				cl.edict.SetInuse(false)
+			}
+
+			err := T.writeLevelFile()
+
+			/* we must restore these for clients to transfer over correctly */
+			for i, cl := range T.svs.clients {
+				cl.edict.SetInuse(savedInuse[i])
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+	}
 
 	// it's possible to start a map with the wrong case, e.g. "/map BASE1"
 	// (even though the mapfile is maps/base1.bsp)
@@ -149,11 +146,14 @@ func sv_GameMap_f(args []string, arg interface{}) error {
 	/* archive server state */
 	T.svs.mapcmd = mmap
 
-	//  /* copy off the level to the autosave slot */
-	//  if (!dedicated->value) {
-	// 	 SV_WriteServerFile(true);
-	// 	 SV_CopySaveGame("current", "save0");
-	//  }
+	/* copy off the level to the autosave slot */
+	if !T.common.Cvar_VariableBool("dedicated") &&
+		!T.common.Cvar_VariableBool("deathmatch") {
+		if err := T.writeServerFile(true); err != nil {
+			return err
+		}
+		T.copySaveGame("current", "save0")
+	}
 	return nil
 }
 
@@ -162,57 +162,325 @@ func sv_GameMap_f(args []string, arg interface{}) error {
  * For development work
  */
 func sv_Map_f(args []string, arg interface{}) error {
-	//  char *map;
-	//  char expanded[MAX_QPATH];
 	T := arg.(*qServer)
 
 	if len(args) != 2 {
-		log.Printf("USAGE: map <mapname>\n")
+		T.common.Com_Printf("USAGE: map <mapname>\n")
 		return nil
 	}
 
 	/* if not a pcx, demo, or cinematic, check to make sure the level exists */
-	// mmap := args[1]
-
-	//  if (!strstr(map, ".") && !strstr(map, "$") && (*map != '*')) {
-	// 	 Com_sprintf(expanded, sizeof(expanded), "maps/%s.bsp", map);
+	mmap := args[1]
 
-	// 	 if (FS_LoadFile(expanded, NULL) == -1)
-	// 	 {
-	// 		 Com_Printf("Can't find %s\n", expanded);
-	// 		 return;
-	// 	 }
-	//  }
+	if !strings.ContainsAny(mmap, ".$+") && !strings.HasPrefix(mmap, "*") {
+		if !T.mapExists(mmap) {
+			T.common.Com_Printf("Can't find maps/%s.bsp\n", mmap)
+			return nil
+		}
+	}
 
 	T.sv.state = ss_dead /* don't save current level when changing */
-	//  SV_WipeSavegame("current");
+	T.wipeSavegame("current")
 	return sv_GameMap_f(args, T)
 }
 
+/*
+ * Returns true if maps/<name>.bsp is
+ * in one of the search paths. The name
+ * may contain a subdirectory.
+ */
+func (T *qServer) mapExists(name string) bool {
+	return T.common.FS_FileExists("maps/" + name + ".bsp")
+}
+
+/*
+ * Lists all maps in all search paths
+ */
+func sv_ListMaps_f(args []string, arg interface{}) error {
+	T := arg.(*qServer)
+
+	maps := T.common.FS_ListMaps()
+
+	T.common.Com_Printf("Maps:\n")
+	for _, m := range maps {
+		T.common.Com_Printf("%s\n", m)
+	}
+	T.common.Com_Printf("%d maps.\n", len(maps))
+	return nil
+}
+
 /*
  * Kick everyone off, possibly in preparation for a new game
  */
-// func sv_KillServer_f(args []string, arg interface{}) error {
-// 	T := arg.(*qServer)
-// 	if !T.svs.initialized {
-// 		return nil
-// 	}
+func sv_KillServer_f(args []string, arg interface{}) error {
+	T := arg.(*qServer)
+	if !T.svs.initialized {
+		return nil
+	}
+
+	T.Shutdown("Server was killed.\n", false)
+	// T.common.NET_Config(false) /* close network sockets */
+	return nil
+}
+
+/*
+ * Begins server demo recording. Every entity and every message will be
+ * recorded, the view is the one of the first player.
+ */
+func (T *qServer) svServerRecord(demoname string) bool {
 
-// 	T.Shutdown("Server was killed.\n", false)
-// 	T.common.NET_Config(false) /* close network sockets */
-// 	return nil
-// }
+	if T.svs.demofile != nil {
+		T.common.Com_Printf("Already recording.\n")
+		return false
+	}
+
+	if T.sv.state != ss_game {
+		T.common.Com_Printf("You must be in a level to record.\n")
+		return false
+	}
+
+	if strings.Contains(demoname, "..") || strings.ContainsAny(demoname, "/\\") {
+		T.common.Com_Printf("Illegal filename.\n")
+		return false
+	}
+
+	/* open the demo file, the filesystem
+	   only finds lower case names */
+	name := fmt.Sprintf("%s/demos/%s.dm2", T.common.FS_Gamedir(), strings.ToLower(demoname))
+
+	T.common.Com_Printf("recording to %s.\n", name)
+	os.MkdirAll(filepath.Dir(name), 0755)
+	f, err := os.Create(name)
+	if err != nil {
+		T.common.Com_Printf("ERROR: couldn't open.\n")
+		return false
+	}
+	T.svs.demofile = f
+
+	/* setup a buffer to catch all multicasts, no
+	   larger than a block a client can read */
+	T.svs.demo_multicast = shared.QWritebufCreate(shared.MAX_MSGLEN)
+	T.svs.demo_multicast.Allowoverflow = true
+
+	/* write the startup info in messages a client can
+	   read, like a client side demo does */
+	buf := shared.QWritebufCreate(shared.MAX_MSGLEN)
+	length := 0
+
+	/* send the serverdata */
+	buf.WriteByte(shared.SvcServerdata)
+	buf.WriteLong(shared.PROTOCOL_VERSION)
+	buf.WriteLong(T.svs.spawncount)
+
+	/* 2 means server demo */
+	buf.WriteByte(2) /* demos are always attract loops */
+	buf.WriteString(T.common.Cvar_VariableString("gamedir"))
+	/* the view follows the first player,
+	   -1 would make it a cinematic */
+	buf.WriteShort(0)
+	/* send full levelname */
+	buf.WriteString(T.sv.configstrings[shared.CS_NAME])
+
+	for i := 0; i < shared.MAX_CONFIGSTRINGS; i++ {
+		if len(T.sv.configstrings[i]) > 0 {
+			if buf.Cursize+len(T.sv.configstrings[i])+32 > shared.MAX_MSGLEN {
+				length += buf.Cursize
+				T.svWriteDemoBlock(buf.Data())
+				buf.Clear()
+			}
+
+			buf.WriteByte(shared.SvcConfigstring)
+			buf.WriteShort(i)
+			buf.WriteString(T.sv.configstrings[i])
+		}
+	}
+
+	nullstate := shared.Entity_state_t{}
+	for i := range T.sv.baselines {
+		base := &T.sv.baselines[i]
+		if base.Modelindex == 0 && base.Sound == 0 && base.Effects == 0 {
+			continue
+		}
+
+		if buf.Cursize+64 > shared.MAX_MSGLEN {
+			length += buf.Cursize
+			T.svWriteDemoBlock(buf.Data())
+			buf.Clear()
+		}
+
+		buf.WriteByte(shared.SvcSpawnbaseline)
+		buf.WriteDeltaEntity(&nullstate, base, true, true)
+	}
+
+	/* write it to the demo file */
+	length += buf.Cursize
+	T.common.Com_Printf("signon message length: %v\n", length)
+	T.svWriteDemoBlock(buf.Data())
+	return true
+}
+
+/*
+ * Writes a length prefixed message into the server demo.
+ */
+func (T *qServer) svWriteDemoBlock(data []byte) {
+	hdr := make([]byte, 4)
+	binary.LittleEndian.PutUint32(hdr, uint32(len(data)))
+	T.svs.demofile.Write(hdr)
+	T.svs.demofile.Write(data)
+}
+
+/*
+ * Ends server demo recording
+ */
+func (T *qServer) svServerStop() {
+	if T.svs.demofile == nil {
+		T.common.Com_Printf("Not doing a serverrecord.\n")
+		return
+	}
+
+	/* mark the end of the demo */
+	hdr := make([]byte, 4)
+	binary.LittleEndian.PutUint32(hdr, 0xFFFFFFFF)
+	T.svs.demofile.Write(hdr)
+
+	T.svs.demofile.Close()
+	T.svs.demofile = nil
+	T.common.Com_Printf("Recording completed.\n")
+}
+
+func sv_ServerRecord_f(args []string, arg interface{}) error {
+	T := arg.(*qServer)
+
+	if len(args) != 2 {
+		T.common.Com_Printf("serverrecord <demoname>\n")
+		return nil
+	}
+
+	T.svServerRecord(args[1])
+	return nil
+}
+
+func sv_ServerStop_f(args []string, arg interface{}) error {
+	T := arg.(*qServer)
+	T.svServerStop()
+	return nil
+}
+
+func sv_Status_f(args []string, arg interface{}) error {
+	T := arg.(*qServer)
+
+	if T.svs.clients == nil {
+		T.common.Com_Printf("No server running.\n")
+		return nil
+	}
+
+	T.common.Com_Printf("map              : %s\n", T.sv.name)
+
+	T.common.Com_Printf("num score ping name            lastmsg address               qport \n")
+	T.common.Com_Printf("--- ----- ---- --------------- ------- --------------------- ------\n")
+
+	for i, cl := range T.svs.clients {
+		if cl.state == cs_free {
+			continue
+		}
+
+		line := fmt.Sprintf("%3v ", i)
+		line += fmt.Sprintf("%5v ", cl.edict.Client().Ps().Stats[shared.STAT_FRAGS])
+
+		if cl.state == cs_connected {
+			line += "CNCT "
+		} else if cl.state == cs_zombie {
+			line += "ZMBI "
+		} else {
+			ping := cl.ping
+			if ping > 9999 {
+				ping = 9999
+			}
+			line += fmt.Sprintf("%4v ", ping)
+		}
+
+		line += fmt.Sprintf("%-16s", cl.name)
+		line += fmt.Sprintf("%7v ", T.svs.realtime-cl.lastmessage)
+		line += fmt.Sprintf("%-22s", cl.addr)
+		line += fmt.Sprintf("%5v", cl.netchan.Qport)
+
+		T.common.Com_Printf("%s\n", line)
+	}
+
+	T.common.Com_Printf("\n")
+	return nil
+}
+
+/*
+ * Writes the entity string of the current
+ * map into the game directory, by default
+ * as maps/<mapname>.ent. With sv_entfile
+ * set it's loaded instead of the BSP lump
+ * the next time the map is started.
+ */
+func sv_DumpEntities_f(args []string, arg interface{}) error {
+	T := arg.(*qServer)
+
+	if T.sv.state != ss_game {
+		T.common.Com_Printf("No map loaded.\n")
+		return nil
+	}
+
+	if len(args) > 2 {
+		T.common.Com_Printf("USAGE: dumpentities [filename]\n")
+		return nil
+	}
+
+	name := fmt.Sprintf("maps/%s.ent", T.sv.name)
+	if len(args) == 2 {
+		name = args[1]
+	}
+
+	if strings.Contains(name, "..") || strings.HasPrefix(name, "/") ||
+		strings.Contains(name, "\\") {
+		T.common.Com_Printf("Bad filename %s.\n", name)
+		return nil
+	}
+
+	name = fmt.Sprintf("%s/%s", T.common.FS_Gamedir(), name)
+	os.MkdirAll(filepath.Dir(name), 0755)
+
+	if err := os.WriteFile(name, []byte(T.common.CMEntityString()), 0644); err != nil {
+		T.common.Com_Printf("Couldn't write %s\n", name)
+		return nil
+	}
+
+	T.common.Com_Printf("Wrote entities to %s.\n", name)
+	return nil
+}
+
+/*
+ * Let the game dll handle a command
+ */
+func sv_ServerCommand_f(args []string, arg interface{}) error {
+	T := arg.(*qServer)
+
+	if T.ge == nil {
+		T.common.Com_Printf("No game loaded.\n")
+		return nil
+	}
+
+	T.cmd_args = args
+	T.ge.ServerCommand()
+	T.cmd_args = nil
+	return T.gameResult(nil)
+}
 
 func (T *qServer) initOperatorCommands() {
 	// Cmd_AddCommand("heartbeat", SV_Heartbeat_f);
 	// Cmd_AddCommand("kick", SV_Kick_f);
-	// Cmd_AddCommand("status", SV_Status_f);
+	T.common.Cmd_AddCommand("status", sv_Status_f, T)
 	// Cmd_AddCommand("serverinfo", SV_Serverinfo_f);
 	// Cmd_AddCommand("dumpuser", SV_DumpUser_f);
 
 	T.common.Cmd_AddCommand("map", sv_Map_f, T)
-	// Cmd_AddCommand("listmaps", SV_ListMaps_f);
-	// T.common.Cmd_AddCommand("demomap", sv_DemoMap_f, T)
+	T.common.Cmd_AddCommand("listmaps", sv_ListMaps_f, T)
+	T.common.Cmd_AddCommand("demomap", sv_DemoMap_f, T)
 	T.common.Cmd_AddCommand("gamemap", sv_GameMap_f, T)
 	// Cmd_AddCommand("setmaster", SV_SetMaster_f);
 
@@ -221,13 +489,14 @@ func (T *qServer) initOperatorCommands() {
 	// 	Cmd_AddCommand("say", SV_ConSay_f);
 	// }
 
-	// Cmd_AddCommand("serverrecord", SV_ServerRecord_f);
-	// Cmd_AddCommand("serverstop", SV_ServerStop_f);
+	T.common.Cmd_AddCommand("serverrecord", sv_ServerRecord_f, T)
+	T.common.Cmd_AddCommand("serverstop", sv_ServerStop_f, T)
 
-	// Cmd_AddCommand("save", SV_Savegame_f);
-	// Cmd_AddCommand("load", SV_Loadgame_f);
+	T.common.Cmd_AddCommand("save", sv_Savegame_f, T)
+	T.common.Cmd_AddCommand("load", sv_Loadgame_f, T)
 
-	// T.common.Cmd_AddCommand("killserver", sv_KillServer_f, T)
+	T.common.Cmd_AddCommand("killserver", sv_KillServer_f, T)
+	T.common.Cmd_AddCommand("dumpentities", sv_DumpEntities_f, T)
 
-	// Cmd_AddCommand("sv", SV_ServerCommand_f);
+	T.common.Cmd_AddCommand("sv", sv_ServerCommand_f, T)
 }
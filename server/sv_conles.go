@@ -26,9 +26,9 @@
 package server
 
 import (
-	"log"
 	"quake2srv/shared"
 	"strconv"
+	"strings"
 )
 
 /*
@@ -86,13 +86,13 @@ func (T *qServer) directConnect(args []string, adr string) error {
 
 	// 	 adr = net_from;
 
-	log.Printf("SVC_DirectConnect ()\n")
+	T.common.Com_Printf("SVC_DirectConnect ()\n")
 
 	version, _ := strconv.ParseInt(args[1], 10, 32)
 
 	if version != shared.PROTOCOL_VERSION {
 		T.common.Netchan_OutOfBandPrint(adr, "print\nServer is protocol version 34.\n")
-		log.Printf("    rejected connect from version %v\n", version)
+		T.common.Com_Printf("    rejected connect from version %v\n", version)
 		return nil
 	}
 
@@ -102,8 +102,8 @@ func (T *qServer) directConnect(args []string, adr string) error {
 
 	userinfo := args[4]
 
-	// 	 /* force the IP key/value pair so the game can filter based on ip */
-	// 	 Info_SetValueForKey(userinfo, "ip", NET_AdrToString(net_from));
+	/* force the IP key/value pair so the game can filter based on ip */
+	userinfo = shared.Info_SetValueForKey(userinfo, "ip", adr)
 
 	// 	 /* attractloop servers are ONLY for local clients */
 	// 	 if (sv.attractloop)
@@ -184,7 +184,7 @@ func (T *qServer) directConnect(args []string, adr string) error {
 
 	if index < 0 {
 		T.common.Netchan_OutOfBandPrint(adr, "print\nServer is full.\n")
-		log.Printf("Rejected a connection.\n")
+		T.common.Com_Printf("Rejected a connection.\n")
 		return nil
 	}
 
@@ -211,27 +211,23 @@ func (T *qServer) directConnect(args []string, adr string) error {
 		// 		 }
 		// 		 else
 		// 		 {
-		// 			 Netchan_OutOfBandPrint(NS_SERVER, adr,
-		// 					 "print\nConnection refused.\n");
+		T.common.Netchan_OutOfBandPrint(adr, "print\nConnection refused.\n")
 		// 		 }
 
-		log.Printf("Game rejected a connection.\n")
+		T.common.Com_Printf("Game rejected a connection.\n")
 		return nil
 	}
 
 	/* parse some info from the info strings */
 	T.svs.clients[index].userinfo = userinfo
-	// T.userinfoChanged(&T.svs.clients[index])
+	T.userinfoChanged(&T.svs.clients[index])
 
-	// 	 /* send the connect packet to the client */
-	// 	 if (sv_downloadserver->string[0])
-	// 	 {
-	// 		 Netchan_OutOfBandPrint(NS_SERVER, adr, "client_connect dlserver=%s", sv_downloadserver->string);
-	// 	 }
-	// 	 else
-	// 	 {
-	T.common.Netchan_OutOfBandPrint(adr, "client_connect")
-	// 	 }
+	/* send the connect packet to the client */
+	if len(T.sv_downloadserver.String) > 0 {
+		T.common.Netchan_OutOfBandPrint(adr, "client_connect dlserver=%s", T.sv_downloadserver.String)
+	} else {
+		T.common.Netchan_OutOfBandPrint(adr, "client_connect")
+	}
 
 	T.svs.clients[index].netchan.Setup(T.common, adr, int(qport))
 
@@ -244,6 +240,45 @@ func (T *qServer) directConnect(args []string, adr string) error {
 	return nil
 }
 
+func (T *qServer) rconValidate(args []string) bool {
+	if len(T.rcon_password.String) == 0 {
+		return false
+	}
+
+	if (len(args) < 2) || (args[1] != T.rcon_password.String) {
+		return false
+	}
+
+	return true
+}
+
+/*
+ * A client issued an rcon command.
+ * Shift down the remaining args
+ * Redirect all printfs
+ */
+func (T *qServer) svcRemoteCommand(s string, args []string, from string) error {
+	/* args[1] is the password, it
+	   must never end up in the log */
+	if !T.rconValidate(args) {
+		T.common.Com_Printf("Bad rcon from %s\n", from)
+	} else {
+		T.common.Com_Printf("Rcon from %s: %s\n", from, strings.Join(args[2:], " "))
+	}
+
+	T.common.Com_BeginRedirect(SV_OUTPUTBUF_LENGTH, func(outputbuf string) {
+		T.common.Netchan_OutOfBandPrint(from, "print\n%s", outputbuf)
+	})
+	defer T.common.Com_EndRedirect()
+
+	if !T.rconValidate(args) {
+		T.common.Com_Printf("Bad rcon_password.\n")
+		return nil
+	}
+
+	return T.common.Cmd_ExecuteString(strings.Join(args[2:], " "))
+}
+
 /*
  * A connectionless packet has four leading 0xff
  * characters to distinguish it from a game channel.
@@ -258,11 +293,10 @@ func (T *qServer) connectionlessPacket(msg *shared.QReadbuf, from string) error
 	msg.ReadLong() /* skip the -1 marker */
 
 	s := msg.ReadStringLine()
-	log.Printf("%s\n", s)
 
 	args := shared.Cmd_TokenizeString(s, false)
 
-	log.Printf("Packet %v : %v\n", from, args[0])
+	T.common.Com_Printf("Packet %v : %v\n", from, args[0])
 
 	switch args[0] {
 	//  if (!strcmp(c, "ping"))
@@ -283,12 +317,10 @@ func (T *qServer) connectionlessPacket(msg *shared.QReadbuf, from string) error
 		return T.getChallenge(args, from)
 	case "connect":
 		return T.directConnect(args, from)
-	//  else if (!strcmp(c, "rcon"))
-	//  {
-	// 	 SVC_RemoteCommand();
-	//  }
+	case "rcon":
+		return T.svcRemoteCommand(s, args, from)
 	default:
-		log.Printf("bad connectionless packet from %v:\n%v\n", from, s)
+		T.common.Com_Printf("bad connectionless packet from %v:\n%v\n", from, s)
 	}
 	return nil
 }
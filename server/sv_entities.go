@@ -28,7 +28,6 @@
 package server
 
 import (
-	"log"
 	"quake2srv/shared"
 )
 
@@ -526,7 +525,7 @@ func (T *qServer) svBuildClientFrame(client *client_t) {
 		state := &T.svs.client_entities[T.svs.next_client_entities%T.svs.num_client_entities]
 
 		if ent.S().Number != e {
-			log.Printf("FIXING ENT->S.NUMBER!!!\n")
+			T.common.Com_Printf("FIXING ENT->S.NUMBER!!!\n")
 			ent.S().Number = e
 		}
 
@@ -541,3 +540,76 @@ func (T *qServer) svBuildClientFrame(client *client_t) {
 		frame.num_entities++
 	}
 }
+
+/*
+ * Save everything in the world out without deltas.
+ * Used for recording footage for merged or assembled demos
+ */
+func (T *qServer) svRecordDemoMessage() {
+
+	if T.svs.demofile == nil {
+		return
+	}
+
+	buf := shared.QWritebufCreate(shared.MAX_MSGLEN)
+
+	/* the frame looks like a frame sent to the first
+	   player, without delta, so clients can play it */
+	frame := client_frame_t{}
+	if cl := T.svs.clients; (len(cl) > 0) && (cl[0].state == cs_spawned) &&
+		(cl[0].edict != nil) && (cl[0].edict.Client() != nil) {
+		frame.ps.Copy(*cl[0].edict.Client().Ps())
+	} else {
+		frame.ps.Fov = 90
+	}
+
+	/* everything is visible */
+	frame.areabytes = T.common.CMWriteAreaBits(frame.areabits[:], 0)
+
+	buf.WriteByte(shared.SvcFrame)
+	buf.WriteLong(T.sv.framenum)
+	buf.WriteLong(-1) /* no delta */
+	buf.WriteByte(0)  /* no dropped packets */
+	buf.WriteByte(frame.areabytes)
+	buf.Write(frame.areabits[:frame.areabytes])
+
+	T.svWritePlayerstateToClient(nil, &frame, buf)
+
+	buf.WriteByte(shared.SvcPacketentities)
+
+	for e := 1; e < T.ge.NumEdicts(); e++ {
+		ent := T.ge.Edict(e)
+
+		if buf.Cursize > shared.MAX_MSGLEN-150 {
+			break
+		}
+
+		/* ignore ents without visible models unless they have an effect */
+		if ent.Inuse() &&
+			ent.S().Number != 0 &&
+			(ent.S().Modelindex != 0 || ent.S().Effects != 0 || ent.S().Sound != 0 ||
+				ent.S().Event != 0) &&
+			(ent.Svflags()&shared.SVF_NOCLIENT) == 0 {
+			/* clients delta new entities from the baseline */
+			buf.WriteDeltaEntity(&T.sv.baselines[ent.S().Number], ent.S(), true, true)
+		}
+	}
+
+	buf.WriteShort(0) /* end of packetentities */
+
+	/* now add the accumulated multicast information,
+	   in a message of its own if it doesn't fit */
+	multicast := T.svs.demo_multicast
+	if multicast.Overflowed {
+		T.common.Com_Printf("WARNING: demo multicast overflowed\n")
+	} else if buf.Cursize+multicast.Cursize <= shared.MAX_MSGLEN {
+		buf.Write(multicast.Data())
+	} else if multicast.Cursize > 0 {
+		T.svWriteDemoBlock(buf.Data())
+		buf = multicast
+	}
+
+	/* now write the entire message to the file, prefixed by the length */
+	T.svWriteDemoBlock(buf.Data())
+	multicast.Clear()
+}
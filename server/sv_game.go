@@ -27,20 +27,152 @@ package server
 
 import (
 	"fmt"
-	"log"
 	"quake2srv/game"
 	"quake2srv/shared"
+	"strings"
 )
 
 type qGameImp struct {
 	T *qServer
 }
 
+/*
+ * Imports can't return errors through the game
+ * code, the first one is kept and returned when
+ * the game hands back control.
+ */
+func (T *qServer) gameError(err error) {
+	if (err != nil) && (T.game_error == nil) {
+		T.game_error = err
+	}
+}
+
+func (T *qServer) gameResult(err error) error {
+	if err == nil {
+		err = T.game_error
+	}
+	T.game_error = nil
+	return err
+}
+
+/*
+ * Sends the contents of the mutlicast buffer to a single client
+ */
+func (G *qGameImp) Unicast(ent shared.Edict_s, reliable bool) {
+	if ent == nil {
+		return
+	}
+
+	p := ent.S().Number
+	if (p < 1) || (p > G.T.maxclients.Int()) {
+		return
+	}
+
+	client := &G.T.svs.clients[p-1]
+
+	if reliable {
+		client.netchan.Message.Write(G.T.sv.multicast.Data())
+	} else {
+		client.datagram.Write(G.T.sv.multicast.Data())
+	}
+
+	G.T.sv.multicast.Clear()
+}
+
+/*
+ * Broadcast print to all clients
+ */
+func (G *qGameImp) Bprintf(printlevel int, format string, a ...interface{}) {
+	G.T.svBroadcastPrintf(printlevel, format, a...)
+}
+
 /*
  * Debug print to server console
  */
 func (G *qGameImp) Dprintf(format string, a ...interface{}) {
-	log.Printf(format, a...)
+	G.T.common.Com_Printf(format, a...)
+}
+
+/*
+ * Print to a single client if the level passes
+ */
+func (G *qGameImp) Cprintf(ent shared.Edict_s, printlevel int, format string, a ...interface{}) {
+	n := 0
+	if ent != nil {
+		n = ent.S().Number
+		if (n < 1) || (n > G.T.maxclients.Int()) {
+			G.T.gameError(G.T.common.Com_Error(shared.ERR_DROP, "cprintf to a non-client"))
+			return
+		}
+	}
+
+	if ent != nil {
+		G.T.svClientPrintf(&G.T.svs.clients[n-1], printlevel, format, a...)
+	} else {
+		G.T.common.Com_Printf(format, a...)
+	}
+}
+
+/*
+ * centerprint to a single client
+ */
+func (G *qGameImp) Centerprintf(ent shared.Edict_s, format string, a ...interface{}) {
+	if ent == nil {
+		return
+	}
+
+	n := ent.S().Number
+	if (n < 1) || (n > G.T.maxclients.Int()) {
+		return
+	}
+
+	G.T.sv.multicast.WriteByte(shared.SvcCenterprint)
+	G.T.sv.multicast.WriteString(fmt.Sprintf(format, a...))
+	G.Unicast(ent, true)
+}
+
+func (G *qGameImp) Sound(ent shared.Edict_s, channel, soundindex int, volume,
+	attenuation, timeofs float32) {
+	if ent == nil {
+		return
+	}
+
+	G.T.gameError(G.T.svStartSound(nil, ent, channel, soundindex, volume, attenuation, timeofs))
+}
+
+func (G *qGameImp) Positioned_sound(origin []float32, ent shared.Edict_s, channel,
+	soundindex int, volume, attenuation, timeofs float32) {
+	if ent == nil {
+		return
+	}
+
+	G.T.gameError(G.T.svStartSound(origin, ent, channel, soundindex, volume, attenuation, timeofs))
+}
+
+func (G *qGameImp) Argc() int {
+	return len(G.T.cmd_args)
+}
+
+func (G *qGameImp) Argv(n int) string {
+	if (n < 0) || (n >= len(G.T.cmd_args)) {
+		return ""
+	}
+	return G.T.cmd_args[n]
+}
+
+func (G *qGameImp) Args() string {
+	if len(G.T.cmd_args) < 2 {
+		return ""
+	}
+	return strings.Join(G.T.cmd_args[1:], " ")
+}
+
+func (G *qGameImp) AddCommandString(text string) {
+	G.T.common.Cbuf_AddText(text)
+}
+
+func (G *qGameImp) Gamedir() string {
+	return G.T.common.FS_Gamedir()
 }
 
 func (G *qGameImp) Cvar(var_name, value string, flags int) *shared.CvarT {
@@ -210,7 +342,6 @@ func (G *qGameImp) Multicast(origin []float32, to shared.Multicast_t) {
 	G.T.svMulticast(origin, to)
 }
 
-// void (*unicast)(edict_t *ent, qboolean reliable);
 // void (*WriteChar)(int c);
 func (G *qGameImp) WriteByte(c int) {
 	G.T.sv.multicast.WriteByte(c)
@@ -265,13 +396,12 @@ func (T *qServer) svShutdownGameProgs() {
 func (T *qServer) svInitGameProgs() error {
 	// 	 game_import_t import;
 
-	// 	 /* unload anything we have now */
-	// 	 if (ge)
-	// 	 {
-	// 		 SV_ShutdownGameProgs();
-	// 	 }
+	/* unload anything we have now */
+	if T.ge != nil {
+		T.svShutdownGameProgs()
+	}
 
-	log.Printf("-------- game initialization -------\n")
+	T.common.Com_Printf("-------- game initialization -------\n")
 
 	/* load a new game dll */
 	// 	 import.multicast = SV_Multicast;
@@ -343,6 +473,6 @@ func (T *qServer) svInitGameProgs() error {
 
 	T.ge.Init()
 
-	log.Printf("------------------------------------\n\n")
+	T.common.Com_Printf("------------------------------------\n\n")
 	return nil
 }
@@ -27,10 +27,10 @@ package server
 
 import (
 	"fmt"
-	"log"
 	"quake2srv/shared"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func (T *qServer) svFindIndex(name string, start, max int, create bool) int {
@@ -111,12 +111,13 @@ func (T *qServer) spawnServer(server, spawnpoint string, serverstate server_stat
 	// 	T.common.Cvar_Set("paused", "0")
 	// }
 
-	log.Printf("------- server initialization ------\n")
-	log.Printf("SpawnServer: %s\n", server)
+	T.common.Com_Printf("------- server initialization ------\n")
+	T.common.Com_Printf("SpawnServer: %s\n", server)
 
-	//  if (sv.demofile) {
-	// 	 FS_FCloseFile(sv.demofile);
-	//  }
+	/* a demo covers only a single level */
+	if T.svs.demofile != nil {
+		T.svServerStop()
+	}
 
 	T.svs.spawncount++ /* any partially connected client will be restarted */
 	T.sv.state = ss_dead
@@ -185,15 +186,15 @@ func (T *qServer) spawnServer(server, spawnpoint string, serverstate server_stat
 	T.common.SetServerState(int(T.sv.state))
 
 	/* load and spawn all other entities */
-	if err := T.ge.SpawnEntities(T.sv.name, T.common.CMEntityString(), spawnpoint); err != nil {
+	if err := T.gameResult(T.ge.SpawnEntities(T.sv.name, T.common.CMEntityString(), spawnpoint)); err != nil {
 		return err
 	}
 
 	/* run two frames to allow everything to settle */
-	if err := T.ge.RunFrame(); err != nil {
+	if err := T.gameResult(T.ge.RunFrame()); err != nil {
 		return err
 	}
-	if err := T.ge.RunFrame(); err != nil {
+	if err := T.gameResult(T.ge.RunFrame()); err != nil {
 		return err
 	}
 
@@ -211,13 +212,21 @@ func (T *qServer) spawnServer(server, spawnpoint string, serverstate server_stat
 	/* create a baseline for more efficient communications */
 	T.createBaseline()
 
-	//  /* check for a savegame */
-	//  SV_CheckForSavegame();
+	/* check for a savegame */
+	if err := T.checkForSavegame(); err != nil {
+		return err
+	}
 
 	/* set serverinfo variable */
 	T.common.Cvar_FullSet("mapname", T.sv.name, shared.CVAR_SERVERINFO|shared.CVAR_NOSET)
 
-	log.Printf("------------------------------------\n\n")
+	/* record every match if requested */
+	if T.sv_autorecord.Bool() && (T.sv.state == ss_game) {
+		name := fmt.Sprintf("%s-%s", T.sv.name, time.Now().Format("20060102-150405"))
+		T.svServerRecord(name)
+	}
+
+	T.common.Com_Printf("------------------------------------\n\n")
 	return nil
 }
 
@@ -229,9 +238,15 @@ func (T *qServer) initGame() error {
 	// 	 edict_t *ent;
 	// 	 char idmaster[32];
 
+	reinit := T.svs.initialized
 	if T.svs.initialized {
 		/* cause any connected clients to reconnect */
 		// T.Shutdown("Server restarted\n", true)
+		for i := range T.svs.clients {
+			if T.svs.clients[i].state > cs_connected {
+				T.svs.clients[i].state = cs_connected
+			}
+		}
 	} else {
 		// 		 /* make sure the client is down */
 		// 		 CL_Drop();
@@ -239,12 +254,12 @@ func (T *qServer) initGame() error {
 	}
 
 	/* get any latched variable changes (maxclients, etc) */
-	// T.common.Cvar_GetLatchedVars()
+	T.common.Cvar_GetLatchedVars()
 
 	T.svs.initialized = true
 
 	if T.common.Cvar_VariableBool("coop") && T.common.Cvar_VariableBool("deathmatch") {
-		log.Printf("Deathmatch and Coop both set, disabling Coop\n")
+		T.common.Com_Printf("Deathmatch and Coop both set, disabling Coop\n")
 		T.common.Cvar_FullSet("coop", "0", shared.CVAR_SERVERINFO|shared.CVAR_LATCH)
 	}
 
@@ -274,10 +289,15 @@ func (T *qServer) initGame() error {
 	}
 
 	T.svs.spawncount = shared.Randk()
-	T.svs.clients = make([]client_t, T.maxclients.Int())
-	for i := range T.svs.clients {
-		T.svs.clients[i].index = i
-		T.svs.clients[i].datagram = shared.QWritebufCreate(shared.MAX_MSGLEN)
+	/* keep the client slots when the game is restarted
+	   (e.g. by loading a savegame), the clients are told
+	   to reconnect after the map is spawned */
+	if !reinit || len(T.svs.clients) != T.maxclients.Int() {
+		T.svs.clients = make([]client_t, T.maxclients.Int())
+		for i := range T.svs.clients {
+			T.svs.clients[i].index = i
+			T.svs.clients[i].datagram = shared.QWritebufCreate(shared.MAX_MSGLEN)
+		}
 	}
 	T.svs.num_client_entities = T.maxclients.Int() * shared.UPDATE_BACKUP * 64
 	T.svs.client_entities = make([]shared.Entity_state_t, T.svs.num_client_entities)
@@ -355,10 +375,10 @@ func (T *qServer) svMap(attractloop bool, levelstring string, loadgame bool) err
 		T.common.Cvar_Set("nextdemo", "")
 	}
 
-	// 	/* hack for end game screen in coop mode */
-	// 	if (Cvar_VariableValue("coop") && !Q_stricmp(level, "victory.pcx")) {
-	// 		Cvar_Set("nextserver", "gamemap \"*base1\"");
-	// 	}
+	/* hack for end game screen in coop mode */
+	if T.common.Cvar_VariableBool("coop") && strings.EqualFold(level, "victory.pcx") {
+		T.common.Cvar_Set("nextserver", "gamemap \"*base1\"")
+	}
 
 	/* if there is a $, use the remainder as a spawnpoint */
 	ch = strings.IndexRune(level, '$')
@@ -368,11 +388,11 @@ func (T *qServer) svMap(attractloop bool, levelstring string, loadgame bool) err
 		level = level[:ch]
 	}
 
-	// 	/* skip the end-of-unit flag if necessary */
-	// 	l = strlen(level);
+	/* skip the end-of-unit flag if necessary */
+	level = strings.TrimPrefix(level, "*")
 
-	if level[0] == '*' {
-		level = level[1:]
+	if len(level) == 0 {
+		return T.common.Com_Error(shared.ERR_DROP, "SV_Map: no level given")
 	}
 
 	if strings.HasSuffix(level, ".cin") {
@@ -402,3 +422,68 @@ func (T *qServer) svMap(attractloop bool, levelstring string, loadgame bool) err
 	T.svBroadcastCommand("reconnect\n")
 	return nil
 }
+
+/*
+ * Returns the files a client needs for the current
+ * map: the models, sounds and images precached by
+ * the game, the sky and the textures of the map.
+ * Sky files are listed as .pcx and .tga, only one
+ * of them is usually there.
+ */
+func (T *qServer) Precache() []string {
+	if T.sv.state != ss_game {
+		return nil
+	}
+
+	var files []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		name = strings.ToLower(name)
+		if !seen[name] {
+			seen[name] = true
+			files = append(files, name)
+		}
+	}
+
+	for i := 1; i < shared.MAX_MODELS; i++ {
+		name := T.sv.configstrings[shared.CS_MODELS+i]
+		/* inline models are part of the map, the
+		   view weapons depend on the player model */
+		if len(name) > 0 && name[0] != '*' && name[0] != '#' {
+			add(name)
+		}
+	}
+
+	for i := 1; i < shared.MAX_SOUNDS; i++ {
+		name := T.sv.configstrings[shared.CS_SOUNDS+i]
+		/* sexed sounds depend on the player model */
+		if len(name) > 0 && name[0] != '*' {
+			add("sound/" + name)
+		}
+	}
+
+	for i := 1; i < shared.MAX_IMAGES; i++ {
+		name := T.sv.configstrings[shared.CS_IMAGES+i]
+		if len(name) == 0 {
+			continue
+		}
+		if name[0] == '/' || name[0] == '\\' {
+			add(name[1:])
+		} else {
+			add(fmt.Sprintf("pics/%s.pcx", name))
+		}
+	}
+
+	if sky := T.sv.configstrings[shared.CS_SKY]; len(sky) > 0 {
+		for _, suf := range []string{"rt", "bk", "lf", "ft", "up", "dn"} {
+			add(fmt.Sprintf("env/%s%s.pcx", sky, suf))
+			add(fmt.Sprintf("env/%s%s.tga", sky, suf))
+		}
+	}
+
+	for _, tex := range T.common.CMTextures() {
+		add(fmt.Sprintf("textures/%s.wal", tex))
+	}
+
+	return files
+}
@@ -26,8 +26,9 @@
 package server
 
 import (
-	"log"
 	"quake2srv/shared"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -38,28 +39,188 @@ import (
  */
 func (Q *qServer) dropClient(drop *client_t) {
 	/* add the disconnect */
-	//  MSG_WriteByte(&drop->netchan.message, svc_disconnect);
+	drop.netchan.Message.WriteByte(shared.SvcDisconnect)
 
-	//  if (drop->state == cs_spawned) {
-	/* call the prog function for removing a client
-	this will remove the body, among other things */
-	//  ge->ClientDisconnect(drop->edict);
-	//  }
+	if drop.state == cs_spawned && Q.ge != nil {
+		/* call the prog function for removing a client
+		this will remove the body, among other things */
+		Q.ge.ClientDisconnect(drop.edict)
+	}
 
-	//  if (drop->download)
-	//  {
-	// 	 FS_FreeFile(drop->download);
-	// 	 drop->download = NULL;
-	//  }
+	drop.download = nil
 
 	drop.state = cs_zombie /* become free in a few seconds */
 	drop.name = ""
 }
 
+/*
+ * Updates the cl->ping variables
+ */
+func (T *qServer) calcPings() {
+
+	for i := range T.svs.clients {
+		cl := &T.svs.clients[i]
+
+		if cl.state != cs_spawned {
+			continue
+		}
+
+		total := 0
+		count := 0
+
+		for j := 0; j < LATENCY_COUNTS; j++ {
+			if cl.frame_latency[j] > 0 {
+				count++
+				total += cl.frame_latency[j]
+			}
+		}
+
+		if count == 0 {
+			cl.ping = 0
+		} else {
+			cl.ping = total / count
+		}
+
+		/* let the game dll know about the ping */
+		cl.edict.Client().SetPing(cl.ping)
+	}
+}
+
+/*
+ * Every few frames, gives all clients an allotment of milliseconds
+ * for their command moves. If they exceed it, assume cheating.
+ */
+func (T *qServer) giveMsec() {
+
+	if (T.sv.framenum & 15) != 0 {
+		return
+	}
+
+	for i := range T.svs.clients {
+		cl := &T.svs.clients[i]
+
+		if cl.state == cs_free {
+			continue
+		}
+
+		if (cl.state == cs_spawned) && (cl.commandMsec < 0) {
+			cl.commandMsecViolations++
+			if T.sv_enforcetime.Bool() {
+				T.common.Com_Printf("%s exceeded the command time budget by %v msec (%v in a row)\n",
+					cl.name, -cl.commandMsec, cl.commandMsecViolations)
+			}
+
+			if T.sv_enforcetime.Bool() && (T.sv_enforcetime_kick.Int() > 0) &&
+				(cl.commandMsecViolations >= T.sv_enforcetime_kick.Int()) {
+				T.svBroadcastPrintf(shared.PRINT_HIGH, "%s was kicked for speed cheating\n", cl.name)
+				/* print directly, because the dropped client
+				   won't get the svBroadcastPrintf message */
+				T.svClientPrintf(cl, shared.PRINT_HIGH, "You were kicked from the game\n")
+				T.dropClient(cl)
+				cl.lastmessage = T.svs.realtime /* in case there is a funny zombie */
+				continue
+			}
+		} else {
+			cl.commandMsecViolations = 0
+		}
+
+		cl.commandMsec = 1600 + T.sv_enforcetime_slop.Int() /* 1600 + some slop */
+	}
+}
+
+/*
+ * Returns the name with the high bits masked
+ * and all characters removed that can't
+ * be printed or that confuse the parsers.
+ */
+func sanitizeName(s string) string {
+	name := make([]byte, 0, len(s))
+
+	for _, c := range []byte(s) {
+		/* mask off high bit */
+		c &= 127
+
+		if (c < ' ') || (c == 127) || strings.IndexByte("\\\";", c) >= 0 {
+			continue
+		}
+
+		name = append(name, c)
+	}
+
+	str := strings.TrimSpace(string(name))
+	if len(str) > 15 {
+		str = str[:15]
+	}
+
+	if len(str) == 0 {
+		return "unnamed"
+	}
+
+	return str
+}
+
+/*
+ * Pull specific info from a newly changed userinfo string
+ * into a more C freindly form.
+ */
+func (T *qServer) userinfoChanged(cl *client_t) {
+
+	/* check for malformed or illegal info strings */
+	if !shared.Info_Validate(cl.userinfo) ||
+		(len(cl.userinfo) >= shared.MAX_INFO_STRING) {
+		cl.userinfo = "\\name\\badinfo\\skin\\male/grunt"
+	}
+
+	/* name for C code */
+	name := sanitizeName(shared.Info_ValueForKey(cl.userinfo, "name"))
+
+	/* don't let the client spam renames */
+	if (len(cl.name) > 0) && (name != cl.name) {
+		if (cl.namechanged > 0) &&
+			(T.svs.realtime-cl.namechanged < 1000*T.sv_namechange_delay.Int()) {
+			T.svClientPrintf(cl, shared.PRINT_HIGH, "You can't change your name that often.\n")
+			name = cl.name
+		} else {
+			cl.namechanged = T.svs.realtime
+		}
+	}
+
+	cl.userinfo = shared.Info_SetValueForKey(cl.userinfo, "name", name)
+	cl.name = name
+
+	/* call prog code to allow overrides */
+	if T.ge != nil {
+		T.ge.ClientUserinfoChanged(cl.edict, cl.userinfo)
+	}
+
+	/* rate command */
+	val := shared.Info_ValueForKey(cl.userinfo, "rate")
+	if len(val) > 0 {
+		i, _ := strconv.Atoi(val)
+		cl.rate = i
+
+		if cl.rate < 100 {
+			cl.rate = 100
+		}
+
+		if cl.rate > 15000 {
+			cl.rate = 15000
+		}
+	} else {
+		cl.rate = 5000
+	}
+
+	/* msg command */
+	val = shared.Info_ValueForKey(cl.userinfo, "msg")
+	if len(val) > 0 {
+		cl.messagelevel, _ = strconv.Atoi(val)
+	}
+}
+
 func (Q *qServer) Init() error {
 	Q.initOperatorCommands()
 
-	// rcon_password = Cvar_Get("rcon_password", "", 0);
+	Q.rcon_password = Q.common.Cvar_Get("rcon_password", "", 0)
 	Q.common.Cvar_Get("skill", "1", 0)
 	Q.common.Cvar_Get("singleplayer", "0", 0)
 	Q.common.Cvar_Get("deathmatch", "0", shared.CVAR_LATCH)
@@ -77,14 +238,21 @@ func (Q *qServer) Init() error {
 	Q.sv_paused = Q.common.Cvar_Get("paused", "0", 0)
 	Q.sv_timedemo = Q.common.Cvar_Get("timedemo", "0", 0)
 	Q.sv_enforcetime = Q.common.Cvar_Get("sv_enforcetime", "0", 0)
+	Q.sv_enforcetime_slop = Q.common.Cvar_Get("sv_enforcetime_slop", "200", 0)
+	Q.sv_enforcetime_kick = Q.common.Cvar_Get("sv_enforcetime_kick", "0", 0)
 	Q.allow_download = Q.common.Cvar_Get("allow_download", "1", shared.CVAR_ARCHIVE)
 	Q.allow_download_players = Q.common.Cvar_Get("allow_download_players", "0", shared.CVAR_ARCHIVE)
 	Q.allow_download_models = Q.common.Cvar_Get("allow_download_models", "1", shared.CVAR_ARCHIVE)
 	Q.allow_download_sounds = Q.common.Cvar_Get("allow_download_sounds", "1", shared.CVAR_ARCHIVE)
 	Q.allow_download_maps = Q.common.Cvar_Get("allow_download_maps", "1", shared.CVAR_ARCHIVE)
+	Q.allow_download_paks = Q.common.Cvar_Get("allow_download_paks", "0", shared.CVAR_ARCHIVE)
 	Q.sv_downloadserver = Q.common.Cvar_Get("sv_downloadserver", "", 0)
 
 	Q.sv_noreload = Q.common.Cvar_Get("sv_noreload", "0", 0)
+	Q.sv_savedir = Q.common.Cvar_Get("sv_savedir", "", shared.CVAR_NOSET)
+	Q.sv_currentdir = Q.common.Cvar_Get("sv_currentdir", "", shared.CVAR_NOSET)
+	Q.sv_autorecord = Q.common.Cvar_Get("sv_autorecord", "0", 0)
+	Q.sv_namechange_delay = Q.common.Cvar_Get("sv_namechange_delay", "5", 0)
 
 	Q.sv_airaccelerate = Q.common.Cvar_Get("sv_airaccelerate", "0", shared.CVAR_LATCH)
 
@@ -138,11 +306,11 @@ func (T *qServer) readPackets() error {
 				if cl.state != cs_zombie {
 					cl.lastmessage = T.svs.realtime /* don't timeout */
 
-					// 			if !(T.sv.demofile != nil && (T.sv.state == ss_demo)) {
-					if err := T.executeClientMessage(&T.svs.clients[i], msg); err != nil {
-						return err
+					if !(T.sv.demofile != nil && (T.sv.state == ss_demo)) {
+						if err := T.executeClientMessage(&T.svs.clients[i], msg); err != nil {
+							return err
+						}
 					}
-					// 			}
 				}
 			}
 
@@ -164,8 +332,8 @@ func (T *qServer) readPackets() error {
 				continue
 			}
 
-			log.Printf("%v disconnected\n", disc)
-			T.svs.clients[i].state = cs_zombie
+			T.common.Com_Printf("%v disconnected\n", disc)
+			T.dropClient(&T.svs.clients[i])
 		}
 	}
 	return nil
@@ -186,7 +354,7 @@ func (T *qServer) checkTimeouts() {
 	//  int droppoint;
 	//  int zombiepoint;
 
-	// droppoint := T.svs.realtime - 1000*T.timeout.Int()
+	droppoint := T.svs.realtime - 1000*T.timeout.Int()
 	zombiepoint := T.svs.realtime - 1000*T.zombietime.Int()
 	droppedSome := false
 
@@ -203,13 +371,13 @@ func (T *qServer) checkTimeouts() {
 			continue
 		}
 
-		// 	 if (((cl->state == cs_connected) || (cl->state == cs_spawned)) &&
-		// 		 (cl->lastmessage < droppoint))
-		// 	 {
-		// 		 SV_BroadcastPrintf(PRINT_HIGH, "%s timed out\n", cl->name);
-		// 		 SV_DropClient(cl);
-		// 		 cl->state = cs_free; /* don't bother with zombie state */
-		// 	 }
+		if ((cl.state == cs_connected) || (cl.state == cs_spawned)) &&
+			(cl.lastmessage < droppoint) {
+			T.svBroadcastPrintf(shared.PRINT_HIGH, "%s timed out\n", cl.name)
+			T.dropClient(&T.svs.clients[i])
+			T.svs.clients[i].state = cs_free /* don't bother with zombie state */
+			droppedSome = true
+		}
 	}
 	if droppedSome {
 		stillAlive := false
@@ -219,6 +387,7 @@ func (T *qServer) checkTimeouts() {
 			}
 		}
 		if !stillAlive {
+			T.svServerStop()
 			T.common.Quit()
 		}
 	}
@@ -241,14 +410,14 @@ func (T *qServer) runGameFrame() error {
 
 	/* don't run if paused */
 	if !T.sv_paused.Bool() || (T.maxclients.Int() > 1) {
-		if err := T.ge.RunFrame(); err != nil {
+		if err := T.gameResult(T.ge.RunFrame()); err != nil {
 			return err
 		}
 
 		/* never get more than one tic behind */
 		if int(T.sv.time) < T.svs.realtime {
 			if T.sv_showclamp.Bool() {
-				log.Printf("sv highclamp\n")
+				T.common.Com_Printf("sv highclamp\n")
 			}
 
 			T.svs.realtime = int(T.sv.time)
@@ -290,7 +459,7 @@ func (T *qServer) Frame(usec int) error {
 		/* never let the time get too far off */
 		if int(T.sv.time)-T.svs.realtime > 100 {
 			if T.sv_showclamp.Bool() {
-				log.Printf("sv lowclamp\n")
+				T.common.Com_Printf("sv lowclamp\n")
 			}
 
 			T.svs.realtime = int(T.sv.time - 100)
@@ -301,10 +470,10 @@ func (T *qServer) Frame(usec int) error {
 	}
 
 	/* update ping based on the last known frame from all clients */
-	// SV_CalcPings();
+	T.calcPings()
 
 	/* give the clients some timeslices */
-	// SV_GiveMsec();
+	T.giveMsec()
 
 	/* let everything in the world think and move */
 	if err := T.runGameFrame(); err != nil {
@@ -312,10 +481,12 @@ func (T *qServer) Frame(usec int) error {
 	}
 
 	/* send messages back to the clients that had packets read this frame */
-	T.svSendClientMessages()
+	if err := T.svSendClientMessages(); err != nil {
+		return err
+	}
 
 	/* save the entire world state if recording a serverdemo */
-	// SV_RecordDemoMessage();
+	T.svRecordDemoMessage()
 
 	/* send a heartbeat to the master if needed */
 	// Master_Heartbeat();
@@ -324,3 +495,56 @@ func (T *qServer) Frame(usec int) error {
 	// SV_PrepWorldFrame();
 	return nil
 }
+
+/*
+ * Used by SV_Shutdown to send a final message to all
+ * connected clients before the server goes down. The
+ * messages are sent immediately, not just stuck on the
+ * outgoing message list, because the server is going
+ * to totally exit after returning from this function.
+ */
+func (T *qServer) finalMessage(message string, reconnect bool) {
+	msg := shared.QWritebufCreate(shared.MAX_MSGLEN)
+	msg.WriteByte(shared.SvcPrint)
+	msg.WriteByte(shared.PRINT_HIGH)
+	msg.WriteString(message)
+
+	if reconnect {
+		msg.WriteByte(shared.SvcReconnect)
+	} else {
+		msg.WriteByte(shared.SvcDisconnect)
+	}
+
+	/* send it twice
+	   stagger the packets to crutch operating system limited buffers */
+	for n := 0; n < 2; n++ {
+		for i := range T.svs.clients {
+			if T.svs.clients[i].state >= cs_connected {
+				T.svs.clients[i].netchan.Transmit(msg.Data())
+			}
+		}
+	}
+}
+
+/*
+ * Called when each game quits,
+ * before Sys_Quit or Sys_Error
+ */
+func (T *qServer) Shutdown(finalmsg string, reconnect bool) {
+	if T.svs.clients != nil {
+		T.finalMessage(finalmsg, reconnect)
+	}
+
+	T.svShutdownGameProgs()
+
+	/* free current level */
+	T.sv = server_t{}
+	T.common.SetServerState(int(T.sv.state))
+
+	/* free server static data */
+	if T.svs.demofile != nil {
+		T.svs.demofile.Close()
+	}
+
+	T.svs = server_static_t{}
+}
@@ -0,0 +1,410 @@
+/*
+ * Copyright (C) 1997-2001 Id Software, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *
+ * See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place - Suite 330, Boston, MA
+ * 02111-1307, USA.
+ *
+ * =======================================================================
+ *
+ * Serverside savegame code. The server writes the configstrings, the
+ * portal state and the latched cvars, everything else is handled by
+ * the game. All files are written as JSON.
+ *
+ * =======================================================================
+ */
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"quake2srv/shared"
+	"strings"
+	"time"
+)
+
+type savedLevelState struct {
+	Configstrings []string
+	Portals       []bool
+}
+
+type savedServerState struct {
+	Comment string
+	Mapcmd  string
+	Cvars   map[string]string
+}
+
+/*
+ * Returns the directory all savegames
+ * are stored in. Several games can run
+ * in the same process, so each of them
+ * may use a directory of it's own.
+ */
+func (T *qServer) saveDir() string {
+	if len(T.sv_savedir.String) > 0 {
+		return fmt.Sprintf("%s/save/%s", T.common.FS_Gamedir(), T.sv_savedir.String)
+	}
+	return fmt.Sprintf("%s/save", T.common.FS_Gamedir())
+}
+
+/*
+ * The levels of the running game are kept
+ * in "current". The saves of a game outlive
+ * it, so the game may keep its levels in
+ * a directory of it's own instead.
+ */
+func (T *qServer) currentDir() string {
+	if len(T.sv_currentdir.String) > 0 {
+		return fmt.Sprintf("%s/save/%s", T.common.FS_Gamedir(), T.sv_currentdir.String)
+	}
+	return fmt.Sprintf("%s/current", T.saveDir())
+}
+
+/*
+ * Returns the directory of a savegame,
+ * "current" is the running game.
+ */
+func (T *qServer) savegameDir(savename string) string {
+	if savename == "current" {
+		return T.currentDir()
+	}
+	return fmt.Sprintf("%s/%s", T.saveDir(), savename)
+}
+
+/*
+ * Delete save/<XXX>/
+ */
+func (T *qServer) wipeSavegame(savename string) {
+	T.common.Com_Printf("SV_WipeSaveGame(%s)\n", savename)
+
+	dir := T.savegameDir(savename)
+	os.Remove(dir + "/server.ssv")
+	os.Remove(dir + "/game.ssv")
+
+	for _, pattern := range []string{"*.sav", "*.sv2"} {
+		files, _ := filepath.Glob(fmt.Sprintf("%s/%s", dir, pattern))
+		for _, f := range files {
+			os.Remove(f)
+		}
+	}
+}
+
+func copyFile(src, dst string) {
+	f1, err := os.Open(src)
+	if err != nil {
+		return
+	}
+	defer f1.Close()
+
+	f2, err := os.Create(dst)
+	if err != nil {
+		return
+	}
+	defer f2.Close()
+
+	io.Copy(f2, f1)
+}
+
+func (T *qServer) copySaveGame(src, dst string) {
+	T.common.Com_Printf("SV_CopySaveGame(%s, %s)\n", src, dst)
+
+	T.wipeSavegame(dst)
+
+	/* copy the savegame over */
+	srcdir := T.savegameDir(src)
+	dstdir := T.savegameDir(dst)
+	os.MkdirAll(dstdir, 0755)
+
+	copyFile(srcdir+"/server.ssv", dstdir+"/server.ssv")
+	copyFile(srcdir+"/game.ssv", dstdir+"/game.ssv")
+
+	files, _ := filepath.Glob(srcdir + "/*.sav")
+	for _, f := range files {
+		name := strings.TrimSuffix(filepath.Base(f), ".sav")
+		copyFile(f, fmt.Sprintf("%s/%s.sav", dstdir, name))
+		copyFile(fmt.Sprintf("%s/%s.sv2", srcdir, name),
+			fmt.Sprintf("%s/%s.sv2", dstdir, name))
+	}
+}
+
+func (T *qServer) writeLevelFile() error {
+	T.common.Com_Printf("SV_WriteLevelFile()\n")
+
+	dir := T.currentDir()
+	os.MkdirAll(dir, 0755)
+
+	s := savedLevelState{
+		Configstrings: T.sv.configstrings[:],
+		Portals:       T.common.CMWritePortalState(),
+	}
+
+	bfr, err := json.MarshalIndent(&s, "", "\t")
+	if err != nil {
+		return T.common.Com_Error(shared.ERR_DROP, "SV_WriteLevelFile: %v", err)
+	}
+
+	name := fmt.Sprintf("%s/%s.sv2", dir, T.sv.name)
+	if err := os.WriteFile(name, bfr, 0644); err != nil {
+		T.common.Com_Printf("Failed to open %s\n", name)
+		return nil
+	}
+
+	return T.ge.WriteLevel(fmt.Sprintf("%s/%s.sav", dir, T.sv.name))
+}
+
+func (T *qServer) readLevelFile() error {
+	T.common.Com_Printf("SV_ReadLevelFile()\n")
+
+	dir := T.currentDir()
+	name := fmt.Sprintf("%s/%s.sv2", dir, T.sv.name)
+	bfr, err := os.ReadFile(name)
+	if err != nil {
+		T.common.Com_Printf("Failed to open %s\n", name)
+		return nil
+	}
+
+	s := savedLevelState{}
+	if err := json.Unmarshal(bfr, &s); err != nil {
+		return T.common.Com_Error(shared.ERR_DROP, "SV_ReadLevelFile: %v", err)
+	}
+
+	copy(T.sv.configstrings[:], s.Configstrings)
+	T.common.CMReadPortalState(s.Portals)
+
+	return T.ge.ReadLevel(fmt.Sprintf("%s/%s.sav", dir, T.sv.name))
+}
+
+func (T *qServer) writeServerFile(autosave bool) error {
+	T.common.Com_Printf("SV_WriteServerFile(%v)\n", autosave)
+
+	dir := T.currentDir()
+	os.MkdirAll(dir, 0755)
+
+	s := savedServerState{Mapcmd: T.svs.mapcmd, Cvars: map[string]string{}}
+
+	/* write the comment field */
+	if !autosave {
+		s.Comment = fmt.Sprintf("%s %s", time.Now().Format("15:04 Jan 02"),
+			T.sv.configstrings[shared.CS_NAME])
+	} else {
+		/* autosaved */
+		s.Comment = fmt.Sprintf("ENTERING %s", T.sv.configstrings[shared.CS_NAME])
+	}
+
+	/* write all CVAR_LATCH cvars
+	   these will be things like coop,
+	   skill, deathmatch, etc */
+	for _, v := range T.common.Cvar_VariablesWithFlags(shared.CVAR_LATCH) {
+		s.Cvars[v.Name] = v.String
+	}
+
+	bfr, err := json.MarshalIndent(&s, "", "\t")
+	if err != nil {
+		return T.common.Com_Error(shared.ERR_DROP, "SV_WriteServerFile: %v", err)
+	}
+
+	name := dir + "/server.ssv"
+	if err := os.WriteFile(name, bfr, 0644); err != nil {
+		T.common.Com_Printf("Couldn't write %s\n", name)
+		return nil
+	}
+
+	/* write game state */
+	return T.ge.WriteGame(dir+"/game.ssv", autosave)
+}
+
+func (T *qServer) readServerFile() error {
+	T.common.Com_Printf("SV_ReadServerFile()\n")
+
+	dir := T.currentDir()
+	name := dir + "/server.ssv"
+	bfr, err := os.ReadFile(name)
+	if err != nil {
+		T.common.Com_Printf("Couldn't read %s\n", name)
+		return nil
+	}
+
+	s := savedServerState{}
+	if err := json.Unmarshal(bfr, &s); err != nil {
+		return T.common.Com_Error(shared.ERR_DROP, "SV_ReadServerFile: %v", err)
+	}
+
+	/* read all CVAR_LATCH cvars
+	   these will be things like
+	   coop, skill, deathmatch, etc */
+	for k, v := range s.Cvars {
+		T.common.Com_Printf("Set %s = %s\n", k, v)
+		T.common.Cvar_ForceSet(k, v)
+	}
+
+	/* start a new game fresh with new cvars */
+	if err := T.initGame(); err != nil {
+		return err
+	}
+
+	T.svs.mapcmd = s.Mapcmd
+
+	/* read game state */
+	return T.ge.ReadGame(dir + "/game.ssv")
+}
+
+/*
+ * Checks whether the current level was
+ * visited before and loads it's state.
+ */
+func (T *qServer) checkForSavegame() error {
+
+	if T.sv_noreload.Bool() {
+		return nil
+	}
+
+	if T.common.Cvar_VariableBool("deathmatch") {
+		return nil
+	}
+
+	name := fmt.Sprintf("%s/%s.sav", T.currentDir(), T.sv.name)
+	if _, err := os.Stat(name); err != nil {
+		return nil /* no savegame */
+	}
+
+	T.svClearWorld()
+
+	/* get configstrings and areaportals */
+	if err := T.readLevelFile(); err != nil {
+		return err
+	}
+
+	if !T.sv.loadgame {
+		/* coming back to a level after being in a different
+		   level, so run it for ten seconds */
+		previousState := T.sv.state
+		T.sv.state = ss_loading
+		for i := 0; i < 100; i++ {
+			if err := T.gameResult(T.ge.RunFrame()); err != nil {
+				return err
+			}
+		}
+		T.sv.state = previousState
+	}
+	return nil
+}
+
+/*
+ * Returns true if the given name can
+ * be used as a savegame directory.
+ */
+func validSavedir(dir string) bool {
+	return !strings.Contains(dir, "..") &&
+		!strings.ContainsAny(dir, "/\\")
+}
+
+func (T *qServer) savegameExists(dir string) bool {
+	_, err := os.Stat(fmt.Sprintf("%s/server.ssv", T.savegameDir(dir)))
+	return err == nil
+}
+
+func sv_Loadgame_f(args []string, arg interface{}) error {
+	T := arg.(*qServer)
+
+	if len(args) != 2 {
+		T.common.Com_Printf("USAGE: loadgame <directory>\n")
+		return nil
+	}
+
+	T.common.Com_Printf("Loading game...\n")
+
+	dir := args[1]
+	if !validSavedir(dir) {
+		T.common.Com_Printf("Bad savedir.\n")
+		return nil
+	}
+
+	/* make sure the server.ssv file exists */
+	if !T.savegameExists(dir) {
+		T.common.Com_Printf("No such savegame: %s\n", dir)
+		return nil
+	}
+
+	T.copySaveGame(dir, "current")
+	if err := T.readServerFile(); err != nil {
+		return err
+	}
+
+	/* go to the map */
+	T.sv.state = ss_dead /* don't save current level when changing */
+	return T.svMap(false, T.svs.mapcmd, true)
+}
+
+func sv_Savegame_f(args []string, arg interface{}) error {
+	T := arg.(*qServer)
+
+	if T.sv.state != ss_game {
+		T.common.Com_Printf("You must be in a game to save.\n")
+		return nil
+	}
+
+	if len(args) != 2 {
+		T.common.Com_Printf("USAGE: savegame <directory>\n")
+		return nil
+	}
+
+	if T.common.Cvar_VariableBool("deathmatch") {
+		T.common.Com_Printf("Can't savegame in a deathmatch\n")
+		return nil
+	}
+
+	dir := args[1]
+	if dir == "current" {
+		T.common.Com_Printf("Can't save to 'current'\n")
+		return nil
+	}
+
+	if T.maxclients.Int() == 1 {
+		cl := &T.svs.clients[0]
+		if cl.state == cs_spawned &&
+			cl.edict.Client().Ps().Stats[shared.STAT_HEALTH] <= 0 {
+			T.common.Com_Printf("\nCan't savegame while dead!\n")
+			return nil
+		}
+	}
+
+	if !validSavedir(dir) {
+		T.common.Com_Printf("Bad savedir.\n")
+		return nil
+	}
+
+	T.common.Com_Printf("Saving game \"%s\"...\n", dir)
+
+	/* archive current level, including all client edicts.
+	   when the level is reloaded, they will be shells awaiting
+	   a connecting client */
+	if err := T.writeLevelFile(); err != nil {
+		return err
+	}
+
+	/* save server state */
+	if err := T.writeServerFile(false); err != nil {
+		return err
+	}
+
+	/* copy it off */
+	T.copySaveGame("current", dir)
+
+	T.common.Com_Printf("Done.\n")
+	return nil
+}
@@ -26,7 +26,9 @@
 package server
 
 import (
+	"encoding/binary"
 	"fmt"
+	"io"
 	"log"
 	"quake2srv/shared"
 )
@@ -49,7 +51,7 @@ func (T *qServer) svSendClientDatagram(client *client_t) bool {
 	   it is necessary for this to be after the WriteEntities
 	   so that entity references will be current */
 	if client.datagram.Overflowed {
-		log.Printf("WARNING: datagram overflowed for %s\n", client.name)
+		T.common.Com_Printf("WARNING: datagram overflowed for %s\n", client.name)
 	} else {
 		msg.Write(client.datagram.Data())
 	}
@@ -58,7 +60,7 @@ func (T *qServer) svSendClientDatagram(client *client_t) bool {
 
 	if msg.Overflowed {
 		/* must have room left for the packet header */
-		log.Printf("WARNING: msg overflowed for %s\n", client.name)
+		T.common.Com_Printf("WARNING: msg overflowed for %s\n", client.name)
 		msg.Clear()
 	}
 
@@ -66,11 +68,71 @@ func (T *qServer) svSendClientDatagram(client *client_t) bool {
 	client.netchan.Transmit(msg.Data())
 
 	/* record the size for rate estimation */
-	// client.message_size[sv.framenum%RATE_MESSAGES] = msg.cursize
+	client.message_size[T.sv.framenum%RATE_MESSAGES] = msg.Cursize
 
 	return true
 }
 
+/*
+ * Returns true if the client is over its current
+ * bandwidth estimation and should not be sent another packet
+ */
+func (T *qServer) rateDrop(c *client_t) bool {
+
+	total := 0
+	for i := 0; i < RATE_MESSAGES; i++ {
+		total += c.message_size[i]
+	}
+
+	if total > c.rate {
+		c.surpressCount++
+		c.message_size[T.sv.framenum%RATE_MESSAGES] = 0
+		return true
+	}
+
+	return false
+}
+
+/*
+ * Sends text across to be displayed if the level passes.
+ */
+func (T *qServer) svClientPrintf(cl *client_t, level int, format string, a ...interface{}) {
+
+	if level < cl.messagelevel {
+		return
+	}
+
+	cl.netchan.Message.WriteByte(shared.SvcPrint)
+	cl.netchan.Message.WriteByte(level)
+	cl.netchan.Message.WriteString(fmt.Sprintf(format, a...))
+}
+
+/*
+ * Sends text to all active clients
+ */
+func (T *qServer) svBroadcastPrintf(level int, format string, a ...interface{}) {
+
+	str := fmt.Sprintf(format, a...)
+
+	/* echo to console */
+	T.common.Com_Printf("%s", str)
+
+	for i := range T.svs.clients {
+		cl := &T.svs.clients[i]
+		if level < cl.messagelevel {
+			continue
+		}
+
+		if cl.state != cs_spawned {
+			continue
+		}
+
+		cl.netchan.Message.WriteByte(shared.SvcPrint)
+		cl.netchan.Message.WriteByte(level)
+		cl.netchan.Message.WriteString(str)
+	}
+}
+
 /*
  * Sends text to all active clients
  */
@@ -112,9 +174,9 @@ func (T *qServer) svMulticast(origin []float32, to shared.Multicast_t) {
 	}
 
 	/* if doing a serverrecord, store everything */
-	//  if (svs.demofile) {
-	// 	 SZ_Write(&svs.demo_multicast, sv.multicast.data, sv.multicast.cursize);
-	//  }
+	if T.svs.demofile != nil {
+		T.svs.demo_multicast.Write(T.sv.multicast.Data())
+	}
 
 	var mask []byte = nil
 	switch to {
@@ -181,41 +243,175 @@ func (T *qServer) svMulticast(origin []float32, to shared.Multicast_t) {
 	T.sv.multicast.Clear()
 }
 
-func (T *qServer) svSendClientMessages() {
+/*
+ * Each entity can have eight independant sound sources, like voice,
+ * weapon, feet, etc.
+ *
+ * If cahnnel & 8, the sound will be sent to everyone, not just
+ * things in the PHS.
+ *
+ * Channel 0 is an auto-allocate channel, the others override anything
+ * already running on that entity/channel pair.
+ *
+ * An attenuation of 0 will play full volume everywhere in the level.
+ * Larger attenuations will drop off.  (max 4 attenuation)
+ *
+ * Timeofs can range from 0.0 to 0.1 to cause sounds to be started
+ * later in the frame than they normally would.
+ *
+ * If origin is NULL, the origin is determined from the entity origin
+ * or the midpoint of the entity box for bmodels.
+ */
+func (T *qServer) svStartSound(origin []float32, entity shared.Edict_s, channel, soundindex int,
+	volume, attenuation, timeofs float32) error {
+
+	if (volume < 0) || (volume > 1.0) {
+		return T.common.Com_Error(shared.ERR_FATAL, "SV_StartSound: volume = %v", volume)
+	}
+
+	if (attenuation < 0) || (attenuation > 4) {
+		return T.common.Com_Error(shared.ERR_FATAL, "SV_StartSound: attenuation = %v", attenuation)
+	}
+
+	if (timeofs < 0) || (timeofs > 0.255) {
+		return T.common.Com_Error(shared.ERR_FATAL, "SV_StartSound: timeofs = %v", timeofs)
+	}
+
+	ent := entity.S().Number
+
+	use_phs := true
+	if (channel & shared.CHAN_NO_PHS_ADD) != 0 { /* no PHS flag */
+		use_phs = false
+		channel &= 7
+	}
+
+	sendchan := (ent << 3) | (channel & 7)
+
+	flags := 0
+	if volume != shared.DEFAULT_SOUND_PACKET_VOLUME {
+		flags |= shared.SND_VOLUME
+	}
+
+	if attenuation != shared.DEFAULT_SOUND_PACKET_ATTENUATION {
+		flags |= shared.SND_ATTENUATION
+	}
+
+	/* the client doesn't know that bmodels have
+	   weird origins the origin can also be
+	   explicitly set */
+	if (entity.Svflags()&shared.SVF_NOCLIENT) != 0 ||
+		(entity.Solid() == shared.SOLID_BSP) ||
+		origin != nil {
+		flags |= shared.SND_POS
+	}
+
+	/* always send the entity number for channel overrides */
+	flags |= shared.SND_ENT
+
+	if timeofs != 0 {
+		flags |= shared.SND_OFFSET
+	}
+
+	/* use the entity origin unless it is a bmodel or explicitly specified */
+	if origin == nil {
+		origin_v := make([]float32, 3)
+		if entity.Solid() == shared.SOLID_BSP {
+			for i := 0; i < 3; i++ {
+				origin_v[i] = entity.S().Origin[i] + 0.5*(entity.Mins()[i]+entity.Maxs()[i])
+			}
+		} else {
+			copy(origin_v, entity.S().Origin[:])
+		}
+		origin = origin_v
+	}
+
+	T.sv.multicast.WriteByte(shared.SvcSound)
+	T.sv.multicast.WriteByte(flags)
+	T.sv.multicast.WriteByte(soundindex)
+
+	if (flags & shared.SND_VOLUME) != 0 {
+		T.sv.multicast.WriteByte(int(volume * 255))
+	}
+
+	if (flags & shared.SND_ATTENUATION) != 0 {
+		T.sv.multicast.WriteByte(int(attenuation * 64))
+	}
+
+	if (flags & shared.SND_OFFSET) != 0 {
+		T.sv.multicast.WriteByte(int(timeofs * 1000))
+	}
+
+	if (flags & shared.SND_ENT) != 0 {
+		T.sv.multicast.WriteShort(sendchan)
+	}
+
+	if (flags & shared.SND_POS) != 0 {
+		T.sv.multicast.WritePos(origin)
+	}
+
+	/* if the sound doesn't attenuate,send it to everyone
+	   (global radio chatter, voiceovers, etc) */
+	if attenuation == shared.ATTN_NONE {
+		use_phs = false
+	}
+
+	if (channel & shared.CHAN_RELIABLE) != 0 {
+		if use_phs {
+			T.svMulticast(origin, shared.MULTICAST_PHS_R)
+		} else {
+			T.svMulticast(origin, shared.MULTICAST_ALL_R)
+		}
+	} else {
+		if use_phs {
+			T.svMulticast(origin, shared.MULTICAST_PHS)
+		} else {
+			T.svMulticast(origin, shared.MULTICAST_ALL)
+		}
+	}
+	return nil
+}
+
+func (T *qServer) svDemoCompleted() {
+	T.sv.demofile = nil
+	T.svNextserver()
+}
+
+func (T *qServer) svSendClientMessages() error {
 
 	var msgbuf []byte = nil
 
 	/* read the next demo message if needed */
-	// if T.sv.demofile != nil && (T.sv.state == ss_demo) {
-	// 	if !T.sv_paused.Bool() {
-	// 		/* get the next message */
-	// 		bfr := T.sv.demofile.Read(4)
-	// 		if len(bfr) != 4 {
-	// 			T.svDemoCompleted()
-	// 			return
-	// 		}
-
-	// 		msglen := int(shared.ReadInt32(bfr))
-	// 		if msglen == -1 {
-	// 			T.svDemoCompleted()
-	// 			return
-	// 		}
-
-	// 		if msglen > shared.MAX_MSGLEN {
-	// 			T.common.Com_Error(shared.ERR_DROP,
-	// 				"SV_SendClientMessages: msglen > MAX_MSGLEN")
-	// 		}
-
-	// 		msgbuf = T.sv.demofile.Read(msglen)
-	// 		if len(msgbuf) != msglen {
-	// 			T.svDemoCompleted()
-	// 			return
-	// 		}
-	// 	}
-	// }
+	if T.sv.demofile != nil && (T.sv.state == ss_demo) {
+		if !T.sv_paused.Bool() {
+			/* get the next message */
+			bfr := make([]byte, 4)
+			if _, err := io.ReadFull(T.sv.demofile, bfr); err != nil {
+				T.svDemoCompleted()
+				return nil
+			}
+
+			msglen := int(int32(binary.LittleEndian.Uint32(bfr)))
+			if msglen == -1 {
+				T.svDemoCompleted()
+				return nil
+			}
+
+			if (msglen < 0) || (msglen > shared.MAX_MSGLEN) {
+				return T.common.Com_Error(shared.ERR_DROP,
+					"SV_SendClientMessages: msglen > MAX_MSGLEN")
+			}
+
+			msgbuf = make([]byte, msglen)
+			if _, err := io.ReadFull(T.sv.demofile, msgbuf); err != nil {
+				T.svDemoCompleted()
+				return nil
+			}
+		}
+	}
 
 	/* send a message to each connected client */
-	for i, c := range T.svs.clients {
+	for i := range T.svs.clients {
+		c := &T.svs.clients[i]
 		if c.state == cs_free {
 			continue
 		}
@@ -224,28 +420,29 @@ func (T *qServer) svSendClientMessages() {
 		   overflowed, drop the
 		   client */
 		if c.netchan.Message.Overflowed {
-			T.svs.clients[i].netchan.Message.Clear()
-			T.svs.clients[i].datagram.Clear()
-			// SV_BroadcastPrintf(PRINT_HIGH, "%s overflowed\n", c->name);
-			// 		SV_DropClient(c);
+			c.netchan.Message.Clear()
+			c.datagram.Clear()
+			T.svBroadcastPrintf(shared.PRINT_HIGH, "%s overflowed\n", c.name)
+			T.dropClient(c)
 		}
 
 		if (T.sv.state == ss_cinematic) ||
 			(T.sv.state == ss_demo) ||
 			(T.sv.state == ss_pic) {
-			T.svs.clients[i].netchan.Transmit(msgbuf)
+			c.netchan.Transmit(msgbuf)
 		} else if c.state == cs_spawned {
-			// 		/* don't overrun bandwidth */
-			// 		if (SV_RateDrop(c)) {
-			// 			continue;
-			// 		}
+			/* don't overrun bandwidth */
+			if T.rateDrop(c) {
+				continue
+			}
 
-			T.svSendClientDatagram(&T.svs.clients[i])
+			T.svSendClientDatagram(c)
 		} else {
 			/* just update reliable	if needed */
 			if c.netchan.Message.Cursize > 0 || (T.common.Curtime()-c.netchan.LastSent) > 1000 {
-				T.svs.clients[i].netchan.Transmit(msgbuf)
+				c.netchan.Transmit(msgbuf)
 			}
 		}
 	}
+	return nil
 }
@@ -0,0 +1,303 @@
+/*
+ * Copyright (C) 1997-2001 Id Software, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *
+ * See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place - Suite 330, Boston, MA
+ * 02111-1307, USA.
+ *
+ * =======================================================================
+ *
+ * Tests of the messages the server writes for prints and sounds.
+ *
+ * =======================================================================
+ */
+package server
+
+import (
+	"quake2srv/common"
+	"quake2srv/shared"
+	"testing"
+	"testing/fstest"
+)
+
+/* an entity with just the fields the sound code reads */
+type testEdict struct {
+	shared.Edict_s
+	s       shared.Entity_state_t
+	svflags int
+	solid   shared.Solid_t
+	mins    [3]float32
+	maxs    [3]float32
+}
+
+func (e *testEdict) S() *shared.Entity_state_t { return &e.s }
+func (e *testEdict) Svflags() int              { return e.svflags }
+func (e *testEdict) Solid() shared.Solid_t     { return e.solid }
+func (e *testEdict) Mins() []float32           { return e.mins[:] }
+func (e *testEdict) Maxs() []float32           { return e.maxs[:] }
+
+/*
+ * A server with two spawned clients and no map,
+ * so only messages to everyone can be sent.
+ */
+func testServer(t *testing.T) *qServer {
+	t.Helper()
+
+	fs := shared.CreateFilesystem("", false, fstest.MapFS{})
+	T := CreateQServer(common.CreateQuekeCommon(fs)).(*qServer)
+	T.maxclients = T.common.Cvar_Get("maxclients", "2", 0)
+	T.sv.multicast = shared.QWritebufCreate(shared.MAX_MSGLEN)
+
+	T.svs.clients = make([]client_t, 2)
+	for i := range T.svs.clients {
+		cl := &T.svs.clients[i]
+		cl.index = i
+		cl.state = cs_spawned
+		cl.netchan.Message = shared.QWritebufCreate(shared.MAX_MSGLEN)
+		cl.datagram = shared.QWritebufCreate(shared.MAX_MSGLEN)
+	}
+	return T
+}
+
+func TestStartSound(t *testing.T) {
+	tests := []struct {
+		name        string
+		origin      []float32
+		entity      testEdict
+		channel     int
+		volume      float32
+		attenuation float32
+		timeofs     float32
+		reliable    bool
+		flags       int
+		volbyte     int
+		attenbyte   int
+		ofsbyte     int
+		sendchan    int
+		pos         []float32
+	}{
+		{
+			name:        "defaults to everyone",
+			entity:      testEdict{s: shared.Entity_state_t{Number: 3, Origin: [3]float32{8, 16, 24}}},
+			channel:     shared.CHAN_VOICE | shared.CHAN_NO_PHS_ADD,
+			volume:      1,
+			attenuation: shared.ATTN_NORM,
+			flags:       shared.SND_ENT,
+			sendchan:    3<<3 | shared.CHAN_VOICE,
+		},
+		{
+			name:        "volume, attenuation and offset",
+			entity:      testEdict{s: shared.Entity_state_t{Number: 1}},
+			channel:     shared.CHAN_WEAPON | shared.CHAN_NO_PHS_ADD,
+			volume:      0.5,
+			attenuation: shared.ATTN_IDLE,
+			timeofs:     0.1,
+			flags:       shared.SND_VOLUME | shared.SND_ATTENUATION | shared.SND_OFFSET | shared.SND_ENT,
+			volbyte:     127,
+			attenbyte:   128,
+			ofsbyte:     100,
+			sendchan:    1<<3 | shared.CHAN_WEAPON,
+		},
+		{
+			name:        "explicit origin",
+			origin:      []float32{-64, 32, 128},
+			entity:      testEdict{s: shared.Entity_state_t{Number: 7}},
+			channel:     shared.CHAN_AUTO,
+			volume:      1,
+			attenuation: shared.ATTN_NONE,
+			flags:       shared.SND_ATTENUATION | shared.SND_ENT | shared.SND_POS,
+			attenbyte:   0,
+			sendchan:    7 << 3,
+			pos:         []float32{-64, 32, 128},
+		},
+		{
+			name: "bmodels use the middle of the box",
+			entity: testEdict{s: shared.Entity_state_t{Number: 12, Origin: [3]float32{100, 0, 0}},
+				solid: shared.SOLID_BSP, mins: [3]float32{-16, -16, 0}, maxs: [3]float32{16, 16, 64}},
+			channel:     shared.CHAN_BODY | shared.CHAN_RELIABLE,
+			volume:      1,
+			attenuation: shared.ATTN_NONE,
+			reliable:    true,
+			flags:       shared.SND_ATTENUATION | shared.SND_ENT | shared.SND_POS,
+			sendchan:    12<<3 | shared.CHAN_BODY,
+			pos:         []float32{100, 0, 32},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			T := testServer(t)
+
+			if err := T.svStartSound(tt.origin, &tt.entity, tt.channel, 5,
+				tt.volume, tt.attenuation, tt.timeofs); err != nil {
+				t.Fatal(err)
+			}
+
+			for i := range T.svs.clients {
+				cl := &T.svs.clients[i]
+				buf, other := cl.datagram, cl.netchan.Message
+				if tt.reliable {
+					buf, other = other, buf
+				}
+				if other.Cursize != 0 {
+					t.Fatalf("client %v: sound sent on the wrong channel", i)
+				}
+
+				msg := shared.QReadbufCreate(buf.Data())
+				if c := msg.ReadByte(); c != shared.SvcSound {
+					t.Fatalf("client %v: got svc %v", i, c)
+				}
+				if flags := msg.ReadByte(); flags != tt.flags {
+					t.Fatalf("flags = %#x, want %#x", flags, tt.flags)
+				}
+				if index := msg.ReadByte(); index != 5 {
+					t.Errorf("soundindex = %v", index)
+				}
+				if (tt.flags & shared.SND_VOLUME) != 0 {
+					if v := msg.ReadByte(); v != tt.volbyte {
+						t.Errorf("volume = %v, want %v", v, tt.volbyte)
+					}
+				}
+				if (tt.flags & shared.SND_ATTENUATION) != 0 {
+					if v := msg.ReadByte(); v != tt.attenbyte {
+						t.Errorf("attenuation = %v, want %v", v, tt.attenbyte)
+					}
+				}
+				if (tt.flags & shared.SND_OFFSET) != 0 {
+					if v := msg.ReadByte(); v != tt.ofsbyte {
+						t.Errorf("timeofs = %v, want %v", v, tt.ofsbyte)
+					}
+				}
+				if v := msg.ReadShort(); v != tt.sendchan {
+					t.Errorf("sendchan = %#x, want %#x", v, tt.sendchan)
+				}
+				if (tt.flags & shared.SND_POS) != 0 {
+					pos := msg.ReadPos()
+					for j := range pos {
+						if pos[j] != tt.pos[j] {
+							t.Errorf("pos = %v, want %v", pos, tt.pos)
+							break
+						}
+					}
+				}
+				if msg.Count() != buf.Cursize {
+					t.Errorf("%v bytes left over", buf.Cursize-msg.Count())
+				}
+			}
+
+			if T.sv.multicast.Cursize != 0 {
+				t.Error("multicast buffer wasn't cleared")
+			}
+		})
+	}
+}
+
+func TestPrints(t *testing.T) {
+	tests := []struct {
+		name     string
+		send     func(T *qServer)
+		level    int /* messagelevel of the clients */
+		reliable []string
+		datagram []string
+	}{
+		{
+			name: "broadcast",
+			send: func(T *qServer) {
+				T.svBroadcastPrintf(shared.PRINT_MEDIUM, "%s died.\n", "player")
+			},
+			reliable: []string{"player died.\n", "player died.\n"},
+		},
+		{
+			name: "broadcast below the message level",
+			send: func(T *qServer) {
+				T.svBroadcastPrintf(shared.PRINT_LOW, "pickup\n")
+			},
+			level: shared.PRINT_MEDIUM,
+		},
+		{
+			name: "client print",
+			send: func(T *qServer) {
+				T.svClientPrintf(&T.svs.clients[1], shared.PRINT_HIGH, "hello %v\n", 2)
+			},
+			reliable: []string{"", "hello 2\n"},
+		},
+		{
+			name: "centerprint is unicast",
+			send: func(T *qServer) {
+				G := &qGameImp{T}
+				G.Centerprintf(&testEdict{s: shared.Entity_state_t{Number: 1}}, "center")
+			},
+			reliable: []string{"center"},
+		},
+		{
+			name: "unreliable unicast",
+			send: func(T *qServer) {
+				T.sv.multicast.WriteByte(shared.SvcCenterprint)
+				T.sv.multicast.WriteString("quiet")
+				G := &qGameImp{T}
+				G.Unicast(&testEdict{s: shared.Entity_state_t{Number: 2}}, false)
+			},
+			datagram: []string{"", "quiet"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			T := testServer(t)
+			for i := range T.svs.clients {
+				T.svs.clients[i].messagelevel = tt.level
+			}
+
+			tt.send(T)
+
+			for i := range T.svs.clients {
+				cl := &T.svs.clients[i]
+				checkPrint(t, i, cl.netchan.Message, tt.reliable)
+				checkPrint(t, i, cl.datagram, tt.datagram)
+			}
+		})
+	}
+}
+
+/*
+ * A print is svc_print, the level and the text,
+ * a centerprint just svc_centerprint and the text.
+ */
+func checkPrint(t *testing.T, i int, buf *shared.QWritebuf, want []string) {
+	t.Helper()
+
+	if (i >= len(want)) || (len(want[i]) == 0) {
+		if buf.Cursize != 0 {
+			t.Errorf("client %v: unexpected message %q", i, buf.Data())
+		}
+		return
+	}
+
+	msg := shared.QReadbufCreate(buf.Data())
+	switch c := msg.ReadByte(); c {
+	case shared.SvcPrint:
+		msg.ReadByte()
+	case shared.SvcCenterprint:
+	default:
+		t.Fatalf("client %v: got svc %v", i, c)
+	}
+
+	if s := msg.ReadString(); s != want[i] {
+		t.Errorf("client %v: got %q, want %q", i, s, want[i])
+	}
+	if msg.Count() != buf.Cursize {
+		t.Errorf("client %v: %v bytes left over", i, buf.Cursize-msg.Count())
+	}
+}
@@ -26,14 +26,25 @@
 package server
 
 import (
+	"bytes"
 	"fmt"
-	"log"
 	"quake2srv/shared"
 	"strconv"
+	"strings"
 )
 
 const maxSTRINGCMDS = 8
 
+func (T *qServer) beginDemoserver() error {
+	name := fmt.Sprintf("demos/%s", T.sv.name)
+	bfr, _ := T.common.LoadFile(name)
+	if bfr == nil {
+		return T.common.Com_Error(shared.ERR_DROP, "Couldn't open %s\n", name)
+	}
+	T.sv.demofile = bytes.NewReader(bfr)
+	return nil
+}
+
 /*
  * Sends the first message from the server to a connected client.
  * This will be sent on the initial connection and upon each server load.
@@ -43,17 +54,17 @@ func sv_New_f(args []string, T *qServer) error {
 	//  int playernum;
 	//  edict_t *ent;
 
-	log.Printf("New() from %s\n", T.sv_client.name)
+	T.common.Com_Printf("New() from %s\n", T.sv_client.name)
 
 	if T.sv_client.state != cs_connected {
-		log.Printf("New not valid -- already spawned\n")
+		T.common.Com_Printf("New not valid -- already spawned\n")
 		return nil
 	}
 
 	/* demo servers just dump the file message */
-	// if T.sv.state == ss_demo {
-	// 	return T.beginDemoserver()
-	// }
+	if T.sv.state == ss_demo {
+		return T.beginDemoserver()
+	}
 
 	/* serverdata needs to go over for all types of servers
 	to make sure the protocol is right, and to set the gamedir */
@@ -99,17 +110,17 @@ func sv_New_f(args []string, T *qServer) error {
 
 func sv_Configstrings_f(args []string, T *qServer) error {
 
-	log.Printf("Configstrings() from %s\n", T.sv_client.name)
+	T.common.Com_Printf("Configstrings() from %s\n", T.sv_client.name)
 
 	if T.sv_client.state != cs_connected {
-		log.Printf("configstrings not valid -- already spawned\n")
+		T.common.Com_Printf("configstrings not valid -- already spawned\n")
 		return nil
 	}
 
 	/* handle the case of a level changing while a client was connecting */
 	sc, _ := strconv.ParseInt(args[1], 10, 32)
 	if int(sc) != T.svs.spawncount {
-		log.Printf("SV_Configstrings_f from different level\n")
+		T.common.Com_Printf("SV_Configstrings_f from different level\n")
 		sv_New_f([]string{}, T)
 		return nil
 	}
@@ -141,17 +152,17 @@ func sv_Configstrings_f(args []string, T *qServer) error {
 
 func sv_Baselines_f(args []string, T *qServer) error {
 
-	log.Printf("Baselines() from %s\n", T.sv_client.name)
+	T.common.Com_Printf("Baselines() from %s\n", T.sv_client.name)
 
 	if T.sv_client.state != cs_connected {
-		log.Printf("baselines not valid -- already spawned\n")
+		T.common.Com_Printf("baselines not valid -- already spawned\n")
 		return nil
 	}
 
 	/* handle the case of a level changing while a client was connecting */
 	sc, _ := strconv.ParseInt(args[1], 10, 32)
 	if int(sc) != T.svs.spawncount {
-		log.Printf("SV_Baselines_f from different level\n")
+		T.common.Com_Printf("SV_Baselines_f from different level\n")
 		sv_New_f([]string{}, T)
 		return nil
 	}
@@ -184,12 +195,12 @@ func sv_Baselines_f(args []string, T *qServer) error {
 }
 
 func sv_Begin_f(args []string, T *qServer) error {
-	log.Printf("Begin() from %s\n", T.sv_client.name)
+	T.common.Com_Printf("Begin() from %s\n", T.sv_client.name)
 
 	/* handle the case of a level changing while a client was connecting */
 	sc, _ := strconv.ParseInt(args[1], 10, 32)
 	if int(sc) != T.svs.spawncount {
-		log.Printf("SV_Begin_f from different level\n")
+		T.common.Com_Printf("SV_Begin_f from different level\n")
 		sv_New_f([]string{}, T)
 		return nil
 	}
@@ -197,7 +208,7 @@ func sv_Begin_f(args []string, T *qServer) error {
 	T.sv_client.state = cs_spawned
 
 	/* call the game begin function */
-	if err := T.ge.ClientBegin(T.sv_player); err != nil {
+	if err := T.gameResult(T.ge.ClientBegin(T.sv_player)); err != nil {
 		return err
 	}
 
@@ -205,6 +216,116 @@ func sv_Begin_f(args []string, T *qServer) error {
 	return nil
 }
 
+func sv_NextDownload_f(args []string, T *qServer) error {
+
+	cl := T.sv_client
+	if cl.download == nil {
+		return nil
+	}
+
+	r := cl.downloadsize - cl.downloadcount
+	if r > 1024 {
+		r = 1024
+	}
+
+	cl.netchan.Message.WriteByte(shared.SvcDownload)
+	cl.netchan.Message.WriteShort(r)
+
+	cl.downloadcount += r
+	size := cl.downloadsize
+	if size == 0 {
+		size = 1
+	}
+
+	percent := cl.downloadcount * 100 / size
+	cl.netchan.Message.WriteByte(percent)
+	cl.netchan.Message.Write(cl.download[cl.downloadcount-r : cl.downloadcount])
+
+	if cl.downloadcount != cl.downloadsize {
+		return nil
+	}
+
+	cl.download = nil
+	return nil
+}
+
+func (T *qServer) refuseDownload() {
+	T.sv_client.netchan.Message.WriteByte(shared.SvcDownload)
+	T.sv_client.netchan.Message.WriteShort(-1)
+	T.sv_client.netchan.Message.WriteByte(0)
+}
+
+func sv_BeginDownload_f(args []string, T *qServer) error {
+
+	if len(args) < 2 {
+		T.refuseDownload()
+		return nil
+	}
+
+	name := args[1]
+	offset := 0
+	if len(args) > 2 {
+		o, _ := strconv.ParseInt(args[2], 10, 32) /* downloaded offset */
+		offset = int(o)
+	}
+
+	/* hacked by zoid to allow more conrol over download
+	   first off, no .. or global allow check */
+	if strings.Contains(name, "..") || strings.ContainsAny(name, "\\:") || !T.allow_download.Bool() ||
+		/* no patterns, the name must match exactly one file */
+		strings.ContainsAny(name, "*?[") ||
+		/* leading dot is no good */
+		strings.HasPrefix(name, ".") ||
+		/* leading slash bad as well, must be in subdir */
+		strings.HasPrefix(name, "/") ||
+		/* next up, skin check */
+		(strings.HasPrefix(name, "players/") && !T.allow_download_players.Bool()) ||
+		/* now models */
+		(strings.HasPrefix(name, "models/") && !T.allow_download_models.Bool()) ||
+		/* now sounds */
+		(strings.HasPrefix(name, "sound/") && !T.allow_download_sounds.Bool()) ||
+		/* now maps (note special case for maps, must not be in pak) */
+		(strings.HasPrefix(name, "maps/") && !T.allow_download_maps.Bool()) ||
+		/* MUST be in a subdirectory */
+		!strings.Contains(name, "/") ||
+		/* no saves, logs or configs, the same as for /qfile/ */
+		!shared.IsAsset(name) {
+		/* don't allow anything with .. path */
+		T.refuseDownload()
+		return nil
+	}
+
+	cl := T.sv_client
+
+	/* don't bother loading what isn't there */
+	if len(T.common.FS_ListFiles(name)) != 1 {
+		T.common.Com_Printf("Couldn't download %s to %s\n", name, cl.name)
+		T.refuseDownload()
+		return nil
+	}
+
+	cl.download, _ = T.common.LoadFile(name)
+	cl.downloadsize = len(cl.download)
+	cl.downloadcount = offset
+
+	if offset > cl.downloadsize || offset < 0 {
+		cl.downloadcount = cl.downloadsize
+	}
+
+	fromPak := cl.download != nil && T.common.FS_FileFromProtectedPak(name)
+	if cl.download == nil ||
+		(fromPak && (strings.HasPrefix(name, "maps/") || !T.allow_download_paks.Bool())) {
+		T.common.Com_Printf("Couldn't download %s to %s\n", name, cl.name)
+		cl.download = nil
+		T.refuseDownload()
+		return nil
+	}
+
+	sv_NextDownload_f(args, T)
+	T.common.Com_Printf("Downloading %s to %s\n", name, cl.name)
+	return nil
+}
+
 /*
  * The client is going to disconnect, so remove the connection immediately
  */
@@ -239,18 +360,90 @@ func (T *qServer) svNextserver() {
  * to the next server,
  */
 func sv_Nextserver_f(args []string, T *qServer) error {
+	if len(args) < 2 {
+		return nil
+	}
+
 	sc, _ := strconv.ParseInt(args[1], 10, 32)
 	if int(sc) != T.svs.spawncount {
-		log.Printf("Nextserver() from wrong level, from %s %v != %v\n", T.sv_client.name, sc, T.svs.spawncount)
+		T.common.Com_Printf("Nextserver() from wrong level, from %s %v != %v\n", T.sv_client.name, sc, T.svs.spawncount)
 		return nil /* leftover from last server */
 	}
 
-	log.Printf("Nextserver() from %s\n", T.sv_client.name)
+	T.common.Com_Printf("Nextserver() from %s\n", T.sv_client.name)
 
 	T.svNextserver()
 	return nil
 }
 
+/*
+ * Web clients have no local server console, so in
+ * single player the player may save and load the
+ * game through the user commands.
+ */
+func sv_ClientSavegame_f(args []string, T *qServer) error {
+	if T.maxclients.Int() != 1 {
+		T.svClientPrintf(T.sv_client, shared.PRINT_HIGH, "Only allowed in single player games.\n")
+		return nil
+	}
+
+	/* the name is checked before it's passed on
+	   to the command buffer */
+	if (len(args) != 2) || !validClientSavename(args[1]) {
+		T.svClientPrintf(T.sv_client, shared.PRINT_HIGH, "USAGE: %s <name>\n", args[0])
+		return nil
+	}
+
+	if args[0] == "load" {
+		if !T.savegameExists(args[1]) {
+			T.svClientPrintf(T.sv_client, shared.PRINT_HIGH, "No such savegame: %s\n", args[1])
+			return nil
+		}
+
+		/* loading spawns a new game, the rest of
+		   this message belongs to the old one */
+		T.common.Cbuf_AddText(fmt.Sprintf("load %s\n", args[1]))
+		return nil
+	}
+
+	if (T.sv.state != ss_game) || (T.sv_client.state != cs_spawned) ||
+		T.common.Cvar_VariableBool("deathmatch") {
+		T.svClientPrintf(T.sv_client, shared.PRINT_HIGH, "You must be in a game to save.\n")
+		return nil
+	}
+
+	if T.sv_client.edict.Client().Ps().Stats[shared.STAT_HEALTH] <= 0 {
+		T.svClientPrintf(T.sv_client, shared.PRINT_HIGH, "Can't savegame while dead!\n")
+		return nil
+	}
+
+	if err := sv_Savegame_f([]string{"savegame", args[1]}, T); err != nil {
+		return err
+	}
+
+	T.svClientPrintf(T.sv_client, shared.PRINT_HIGH, "Game saved to %s.\n", args[1])
+	return nil
+}
+
+/*
+ * Savegame names of clients are limited
+ * to letters, digits, '-' and '_'.
+ */
+func validClientSavename(name string) bool {
+	if (len(name) == 0) || (len(name) > 32) || (name == "current") {
+		return false
+	}
+
+	for _, c := range name {
+		if !(((c >= 'a') && (c <= 'z')) || ((c >= 'A') && (c <= 'Z')) ||
+			((c >= '0') && (c <= '9')) || (c == '-') || (c == '_')) {
+			return false
+		}
+	}
+
+	return true
+}
+
 var ucmds = map[string](func([]string, *qServer) error){
 	/* auto issued */
 	"new":           sv_New_f,
@@ -260,7 +453,12 @@ var ucmds = map[string](func([]string, *qServer) error){
 	"nextserver":    sv_Nextserver_f,
 	"disconnect":    sv_Disconnect_f,
 
+	"download": sv_BeginDownload_f,
+	"nextdl":   sv_NextDownload_f,
+
 	/* issued by hand at client consoles */
+	"save": sv_ClientSavegame_f,
+	"load": sv_ClientSavegame_f,
 	// {"info", SV_ShowServerinfo_f},
 }
 
@@ -278,20 +476,77 @@ func (T *qServer) executeUserCommand(s string) error {
 
 	println("executeUserCommand", args[0])
 	if T.sv.state == ss_game {
+		T.cmd_args = args
 		T.ge.ClientCommand(T.sv_player, args)
+		T.cmd_args = nil
+		return T.gameResult(nil)
 	}
 	return nil
 }
 
-func (T *qServer) svClientThink(cl *client_t, cmd *shared.Usercmd_t) {
+/*
+ * Clamps a move command to the values
+ * an unmodified client is able to send.
+ * The angles are relative to the delta
+ * angles of the player, the view never
+ * rolls and the pitch stays in the range
+ * Pmove allows.
+ */
+func (T *qServer) svSanitizeUsercmd(cl *client_t, cmd *shared.Usercmd_t) {
+	clamped := false
+
+	if cmd.Msec > MAX_USERCMD_MSEC {
+		cmd.Msec = MAX_USERCMD_MSEC
+		clamped = true
+	}
+
+	for _, move := range []*int16{&cmd.Forwardmove, &cmd.Sidemove, &cmd.Upmove} {
+		if *move > MAX_USERCMD_MOVE {
+			*move = MAX_USERCMD_MOVE
+			clamped = true
+		} else if *move < -MAX_USERCMD_MOVE {
+			*move = -MAX_USERCMD_MOVE
+			clamped = true
+		}
+	}
+
+	if (cl.edict != nil) && (cl.edict.Client() != nil) {
+		delta := cl.edict.Client().Ps().Pmove.Delta_angles
+
+		pitch := cmd.Angles[shared.PITCH] + delta[shared.PITCH]
+		if pitch > MAX_USERCMD_PITCH {
+			cmd.Angles[shared.PITCH] = MAX_USERCMD_PITCH - delta[shared.PITCH]
+			clamped = true
+		} else if pitch < -MAX_USERCMD_PITCH {
+			cmd.Angles[shared.PITCH] = -MAX_USERCMD_PITCH - delta[shared.PITCH]
+			clamped = true
+		}
+
+		if cmd.Angles[shared.ROLL]+delta[shared.ROLL] != 0 {
+			cmd.Angles[shared.ROLL] = -delta[shared.ROLL]
+			clamped = true
+		}
+	}
+
+	if clamped && T.sv_enforcetime.Bool() && T.sv_showclamp.Bool() {
+		T.common.Com_Printf("usercmd from %s clamped\n", cl.name)
+	}
+}
+
+func (T *qServer) svClientThink(cl *client_t, cmd *shared.Usercmd_t) error {
+	T.svSanitizeUsercmd(cl, cmd)
+
 	cl.commandMsec -= int(cmd.Msec)
 
 	if (cl.commandMsec < 0) && T.sv_enforcetime.Bool() {
-		log.Printf("commandMsec underflow from %s\n", cl.name)
-		return
+		if T.sv_showclamp.Bool() {
+			T.common.Com_Printf("commandMsec underflow from %s\n", cl.name)
+		}
+		return nil
 	}
 
 	T.ge.ClientThink(cl.edict, cmd)
+	return T.gameResult(nil)
 }
 
 /*
@@ -319,7 +574,7 @@ func (T *qServer) executeClientMessage(cl *client_t, msg *shared.QReadbuf) error
 
 	for {
 		if msg.IsOver() {
-			log.Printf("SV_ReadClientMessage: badread\n")
+			T.common.Com_Printf("SV_ReadClientMessage: badread\n")
 			// SV_DropClient(cl)
 			return nil
 		}
@@ -336,7 +591,7 @@ func (T *qServer) executeClientMessage(cl *client_t, msg *shared.QReadbuf) error
 
 		case shared.ClcUserinfo:
 			cl.userinfo = msg.ReadString()
-			// 			 SV_UserinfoChanged(cl);
+			T.userinfoChanged(cl)
 
 		case shared.ClcMove:
 
@@ -352,10 +607,10 @@ func (T *qServer) executeClientMessage(cl *client_t, msg *shared.QReadbuf) error
 			if lastframe != cl.lastframe {
 				cl.lastframe = lastframe
 
-				// if cl.lastframe > 0 {
-				// 	cl.frame_latency[cl.lastframe&(LATENCY_COUNTS-1)] =
-				// 		svs.realtime - cl.frames[cl.lastframe&UPDATE_MASK].senttime
-				// }
+				if cl.lastframe > 0 {
+					cl.frame_latency[cl.lastframe&(LATENCY_COUNTS-1)] =
+						T.svs.realtime - cl.frames[cl.lastframe&shared.UPDATE_MASK].senttime
+				}
 			}
 
 			// 			 memset(&nullcmd, 0, sizeof(nullcmd));
@@ -389,21 +644,29 @@ func (T *qServer) executeClientMessage(cl *client_t, msg *shared.QReadbuf) error
 
 				if net_drop < 20 {
 					for net_drop > 2 {
-						T.svClientThink(cl, &cl.lastcmd)
+						if err := T.svClientThink(cl, &cl.lastcmd); err != nil {
+							return err
+						}
 
 						net_drop--
 					}
 
 					if net_drop > 1 {
-						T.svClientThink(cl, &oldest)
+						if err := T.svClientThink(cl, &oldest); err != nil {
+							return err
+						}
 					}
 
 					if net_drop > 0 {
-						T.svClientThink(cl, &oldcmd)
+						if err := T.svClientThink(cl, &oldcmd); err != nil {
+							return err
+						}
 					}
 				}
 
-				T.svClientThink(cl, &newcmd)
+				if err := T.svClientThink(cl, &newcmd); err != nil {
+					return err
+				}
 			}
 
 			cl.lastcmd.Copy(newcmd)
@@ -424,8 +687,8 @@ func (T *qServer) executeClientMessage(cl *client_t, msg *shared.QReadbuf) error
 			}
 
 		default:
-			log.Printf("SV_ReadClientMessage: unknown command char\n")
-			// 			 SV_DropClient(cl);
+			T.common.Com_Printf("SV_ReadClientMessage: unknown command char\n")
+			T.dropClient(cl)
 			return nil
 		}
 	}
@@ -246,7 +246,7 @@ func (T *qServer) svLinkEdict(ent shared.Edict_s) {
 			if ent.Areanum() != 0 && (ent.Areanum() != area) {
 				if ent.Areanum2() != 0 && (ent.Areanum2() != area) &&
 					(T.sv.state == ss_loading) {
-					log.Printf("Object touching 3 areas at %f %f %f\n",
+					T.common.Com_Printf("Object touching 3 areas at %f %f %f\n",
 						ent.Absmin()[0], ent.Absmin()[1], ent.Absmin()[2])
 				}
 
@@ -357,7 +357,7 @@ func (T *qServer) svAreaEdicts_r(node *areanode_t) {
 		}
 
 		if T.area_count == T.area_maxcount {
-			log.Printf("SV_AreaEdicts: MAXCOUNT\n")
+			T.common.Com_Printf("SV_AreaEdicts: MAXCOUNT\n")
 			return
 		}
 
@@ -63,7 +63,7 @@ type Dtriangle_t struct {
 	Index_st  [3]int16
 }
 
-const Dtriangle_size = 6 * 4
+const Dtriangle_size = 6 * 2
 
 func Dtriangle(data []byte) Dtriangle_t {
 	d := Dtriangle_t{}
@@ -223,6 +223,45 @@ func Dsprite(data []byte) Dsprite_t {
 	return d
 }
 
+/* .PCX image file format */
+
+type Pcx_t struct {
+	Manufacturer   byte
+	Version        byte
+	Encoding       byte
+	Bits_per_pixel byte
+	Xmin, Ymin     uint16
+	Xmax, Ymax     uint16
+	Hres, Vres     uint16
+	Palette        [48]byte
+	Reserved       byte
+	Color_planes   byte
+	Bytes_per_line uint16
+	Palette_type   uint16
+}
+
+const Pcx_size = 128 /* the pixel data follows the header */
+
+func Pcx(data []byte) Pcx_t {
+	d := Pcx_t{}
+	d.Manufacturer = data[0]
+	d.Version = data[1]
+	d.Encoding = data[2]
+	d.Bits_per_pixel = data[3]
+	d.Xmin = ReadUint16(data[4:])
+	d.Ymin = ReadUint16(data[6:])
+	d.Xmax = ReadUint16(data[8:])
+	d.Ymax = ReadUint16(data[10:])
+	d.Hres = ReadUint16(data[12:])
+	d.Vres = ReadUint16(data[14:])
+	copy(d.Palette[:], data[16:])
+	d.Reserved = data[64]
+	d.Color_planes = data[65]
+	d.Bytes_per_line = ReadUint16(data[66:])
+	d.Palette_type = ReadUint16(data[68:])
+	return d
+}
+
 /* .WAL texture file format */
 
 const MIPLEVELS = 4
@@ -235,8 +274,11 @@ type Miptex_t struct {
 	Animname string            /* next frame in animation chain */
 	Flags    int32
 	Contents int32
+	Value    int32
 }
 
+const Miptex_size = 2*32 + (5+MIPLEVELS)*4
+
 func Miptex(data []byte) Miptex_t {
 	d := Miptex_t{}
 	d.Name = ReadString(data, 32)
@@ -248,6 +290,7 @@ func Miptex(data []byte) Miptex_t {
 	d.Animname = ReadString(data[32+(2+MIPLEVELS)*4:], 32)
 	d.Flags = ReadInt32(data[2*32+(2+MIPLEVELS)*4:])
 	d.Contents = ReadInt32(data[2*32+(3+MIPLEVELS)*4:])
+	d.Value = ReadInt32(data[2*32+(4+MIPLEVELS)*4:])
 	return d
 }
 
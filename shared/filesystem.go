@@ -27,10 +27,19 @@
 package shared
 
 import (
+	"archive/zip"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"os"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 /* The .pak files are just a linear collapse of a directory tree */
@@ -75,22 +84,238 @@ const MAX_HANDLES = 512
 type fsPackFile_t struct {
 	name   string
 	size   int
-	offset int64 /* Ignored in PK3 files. */
+	offset int64     /* Ignored in PK3 files. */
+	zfile  *zip.File /* Only used in PK3 files. */
+}
+
+/* Pak and pk3 files are read only io/fs file systems. */
+type fsPackFileInfo_t struct {
+	name  string
+	size  int64
+	mtime time.Time
+	isDir bool
+}
+
+func (fi *fsPackFileInfo_t) Name() string               { return fi.name }
+func (fi *fsPackFileInfo_t) Size() int64                { return fi.size }
+func (fi *fsPackFileInfo_t) ModTime() time.Time         { return fi.mtime }
+func (fi *fsPackFileInfo_t) IsDir() bool                { return fi.isDir }
+func (fi *fsPackFileInfo_t) Sys() interface{}           { return nil }
+func (fi *fsPackFileInfo_t) Type() fs.FileMode          { return fi.Mode().Type() }
+func (fi *fsPackFileInfo_t) Info() (fs.FileInfo, error) { return fi, nil }
+
+func (fi *fsPackFileInfo_t) Mode() fs.FileMode {
+	if fi.isDir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+type fsPackFileHandle_t struct {
+	info *fsPackFileInfo_t
+	r    io.Reader
+	c    io.Closer
+}
+
+func (f *fsPackFileHandle_t) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *fsPackFileHandle_t) Read(b []byte) (int, error) { return f.r.Read(b) }
+
+func (f *fsPackFileHandle_t) Close() error {
+	if f.c != nil {
+		return f.c.Close()
+	}
+	return nil
+}
+
+/* Files in paks can be seeked, e.g. for HTTP range requests. */
+type fsPakFileHandle_t struct {
+	*io.SectionReader
+	info *fsPackFileInfo_t
+}
+
+func (f *fsPakFileHandle_t) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *fsPakFileHandle_t) Close() error               { return nil }
+
+/* A directory, either in a pack or merged over the search path. */
+type fsDirHandle_t struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *fsDirHandle_t) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *fsDirHandle_t) Close() error               { return nil }
+
+func (d *fsDirHandle_t) Read(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+func (d *fsDirHandle_t) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > len(rest) {
+		n = len(rest)
+	}
+
+	d.offset += n
+	return rest[:n], nil
+}
+
+/*
+ * Directories and other file systems may have
+ * names in any case. This shows them in lower
+ * case like the files of the packs, a name is
+ * resolved one directory at a time.
+ */
+type fsLower_t struct {
+	fsys fs.FS
+}
+
+type fsLowerInfo_t struct {
+	fs.FileInfo
+}
+
+func (fi *fsLowerInfo_t) Name() string { return strings.ToLower(fi.FileInfo.Name()) }
+
+type fsLowerEntry_t struct {
+	fs.DirEntry
+}
+
+func (e *fsLowerEntry_t) Name() string { return strings.ToLower(e.DirEntry.Name()) }
+
+func (e *fsLowerEntry_t) Info() (fs.FileInfo, error) {
+	info, err := e.DirEntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return &fsLowerInfo_t{info}, nil
+}
+
+type fsLowerFile_t struct {
+	fs.File
+}
+
+func (f *fsLowerFile_t) Stat() (fs.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &fsLowerInfo_t{info}, nil
+}
+
+/*
+ * Returns the real name of a file, or the
+ * name itself if there's no such file.
+ */
+func (l *fsLower_t) resolve(name string) string {
+	if _, err := fs.Stat(l.fsys, name); (err == nil) || (name == ".") {
+		return name
+	}
+
+	real := "."
+	for _, part := range strings.Split(name, "/") {
+		entries, err := fs.ReadDir(l.fsys, real)
+		if err != nil {
+			return name
+		}
+
+		found := false
+		for _, e := range entries {
+			if strings.EqualFold(e.Name(), part) {
+				real = path.Join(real, e.Name())
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return name
+		}
+	}
+
+	return real
+}
+
+func (l *fsLower_t) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	f, err := l.fsys.Open(l.resolve(name))
+	if err != nil {
+		return nil, err
+	}
+	return &fsLowerFile_t{f}, nil
+}
+
+func (l *fsLower_t) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	info, err := fs.Stat(l.fsys, l.resolve(name))
+	if err != nil {
+		return nil, err
+	}
+	return &fsLowerInfo_t{info}, nil
+}
+
+func (l *fsLower_t) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	list, err := fs.ReadDir(l.fsys, l.resolve(name))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]fs.DirEntry, len(list))
+	for i, e := range list {
+		entries[i] = &fsLowerEntry_t{e}
+	}
+	return entries, nil
 }
 
 type fsPack_t struct {
-	name string
-	pak  *os.File
-	// int numFiles;
-	// FILE *pak;
-	// unzFile *pk3;
-	// qboolean isProtectedPak;
-	files []fsPackFile_t
+	name  string
+	pak   *os.File
+	pk3   *zip.ReadCloser
+	mtime time.Time
+	files map[string]fsPackFile_t
+}
+
+type fsPackFormat_t int
+
+const (
+	PAK fsPackFormat_t = iota
+	PK3
+)
+
+type fsPackType_t struct {
+	suffix string
+	format fsPackFormat_t
+}
+
+var fs_packtypes = []fsPackType_t{
+	{"pak", PAK},
+	{"pk2", PK3},
+	{"pk3", PK3},
+	{"pkz", PK3},
 }
 
 type fsSearchPath_t struct {
-	path string    /* Only one used. */
-	pack *fsPack_t /* (path or pack) */
+	name      string /* directory or pak, for messages */
+	fsys      fs.FS
+	protected bool /* files are never offered for download */
 }
 
 const (
@@ -99,14 +324,32 @@ const (
 	maxPAKS    = 100
 )
 
+/* explicit order of the non numbered paks */
+const PAKLIST = "paks.lst"
+
 type QFileSystem interface {
+	fs.ReadDirFS
+	fs.StatFS
+
 	LoadFile(path string) ([]byte, error)
+	ListFiles(pattern string) ([]string, error)
+	Gamedir() string
+	FileFromProtectedPak(path string) bool
+	GameFilesystem(game string) (QFileSystem, error)
+	AllowGames(games ...string)
 }
 
 type qFileSystem struct {
+	fs_basedir     string
 	fs_gamedir     string
 	fs_debug       bool
 	fs_searchPaths []fsSearchPath_t
+
+	/* search paths of the mods, only used
+	   in the baseq2 filesystem */
+	fs_games    map[string]*qFileSystem
+	fs_allowed  map[string]bool /* mods that may be used */
+	fs_games_mu sync.Mutex
 }
 
 /*
@@ -114,12 +357,36 @@ type qFileSystem struct {
  * return the file length without loading.
  */
 func (T *qFileSystem) LoadFile(path string) ([]byte, error) {
-	// file_from_protected_pak = false;
-	// handle = FS_HandleForFile(name, f);
-	// Q_strlcpy(handle->name, name, sizeof(handle->name));
-	// handle->mode = FS_READ;
 	path = strings.ToLower(path)
 
+	bfr, err := fs.ReadFile(T, path)
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) {
+		// if T.fs_debug {
+		log.Printf("FS_LoadFile: couldn't find '%s'.\n", path)
+		// }
+		return nil, nil
+	} else if err != nil {
+		log.Printf("FS_LoadFile: Failed to read file %v\n", err.Error())
+		return nil, err
+	}
+
+	return bfr, nil
+}
+
+/*
+ * Opens a file in the search path, the first
+ * search path containing the file wins. Names
+ * are case insensitive. Opening a directory
+ * returns the merged directory of all search
+ * paths.
+ */
+func (T *qFileSystem) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	name = strings.ToLower(name)
+
 	/* Search through the path, one element at a time. */
 	for _, search := range T.fs_searchPaths {
 
@@ -131,57 +398,262 @@ func (T *qFileSystem) LoadFile(path string) ([]byte, error) {
 		// 	}
 		// }
 
-		/* Search inside a pack file. */
-		if search.pack != nil {
-			pack := search.pack
-
-			for _, f := range pack.files {
-				if f.name == path {
-					/* Found it! */
-					if T.fs_debug {
-						log.Printf("FS_LoadFile: '%s' (found in '%s').\n", path, pack.name)
-					}
-
-					bfr := make([]byte, f.size)
-					_, err := pack.pak.ReadAt(bfr, f.offset)
-					if err != nil {
-						log.Printf("FS_LoadFile: Failed to read from pack %v\n", err.Error())
-						return nil, err
-					}
-
-					return bfr, nil
-				}
+		st, err := fs.Stat(search.fsys, name)
+		if err != nil {
+			continue
+		}
+
+		if st.IsDir() {
+			entries, err := T.ReadDir(name)
+			if err != nil {
+				return nil, err
 			}
-		} else {
-			/* Search in a directory tree. */
-			path := fmt.Sprintf("%v/%v", search.path, path)
-			handle, err := os.Open(path)
-			if err == nil {
-
-				if T.fs_debug {
-					log.Printf("FS_LoadFile: '%s' (found in '%s').\n", path, search.path)
-				}
-
-				st, _ := handle.Stat()
-				size := st.Size()
-
-				bfr := make([]byte, int(size))
-				_, err := handle.Read(bfr)
-				if err != nil {
-					log.Printf("FS_LoadFile: Failed to read file %v\n", err.Error())
-					return nil, err
-				}
-
-				handle.Close()
-				return bfr, nil
+			return &fsDirHandle_t{info: st, entries: entries}, nil
+		}
+
+		/* Found it! */
+		if T.fs_debug {
+			log.Printf("FS_LoadFile: '%s' (found in '%s').\n", name, search.name)
+		}
+
+		return search.fsys.Open(name)
+	}
+
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+/*
+ * Returns the file info of the file Open would return.
+ */
+func (T *qFileSystem) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	name = strings.ToLower(name)
+
+	for _, search := range T.fs_searchPaths {
+		if st, err := fs.Stat(search.fsys, name); err == nil {
+			return st, nil
+		}
+	}
+
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+/*
+ * Lists a directory over all search paths. A file
+ * in a search path hides files with the same name
+ * in the search paths below it. The entries are
+ * sorted by name.
+ */
+func (T *qFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	name = strings.ToLower(name)
+
+	found := false
+	seen := make(map[string]bool)
+	var entries []fs.DirEntry
+
+	for _, search := range T.fs_searchPaths {
+		list, err := fs.ReadDir(search.fsys, name)
+		if err != nil {
+			continue
+		}
+
+		found = true
+
+		for _, e := range list {
+			key := strings.ToLower(e.Name())
+			if seen[key] {
+				continue
 			}
 
+			seen[key] = true
+			entries = append(entries, e)
+		}
+	}
+
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+/*
+ * Returns the names of all files and directories
+ * matching the pattern (see path.Match, e.g.
+ * "maps/*.bsp" or "players/*") in all search
+ * paths, sorted by name. A name is returned only
+ * once, even if it's in more than one search path.
+ */
+func (T *qFileSystem) ListFiles(pattern string) ([]string, error) {
+	return fs.Glob(T, strings.ToLower(pattern))
+}
+
+/*
+ * Returns the names of all maps, e.g. "base1"
+ * for maps/base1.bsp.
+ */
+func ListMaps(q QFileSystem) []string {
+	list, err := q.ListFiles("maps/*.bsp")
+	if err != nil {
+		return nil
+	}
+
+	maps := make([]string, 0, len(list))
+	for _, name := range list {
+		maps = append(maps, strings.TrimSuffix(path.Base(name), ".bsp"))
+	}
+
+	return maps
+}
+
+/*
+ * The types of files clients may download,
+ * with their content type.
+ */
+var AssetTypes = map[string]string{
+	".bsp": "application/octet-stream",
+	".md2": "application/octet-stream",
+	".sp2": "application/octet-stream",
+	".wal": "application/octet-stream",
+	".dm2": "application/octet-stream",
+	".lst": "text/plain; charset=utf-8",
+	".pcx": "image/x-pcx",
+	".tga": "image/x-tga",
+	".png": "image/png",
+	".jpg": "image/jpeg",
+	".wav": "audio/wav",
+	".ogg": "audio/ogg",
+	".pk3": "application/zip",
+}
+
+/*
+ * Savegames, configs and logs live in the
+ * game directory too, but may contain the
+ * rcon password. Only assets of the known
+ * types are sent to clients, by the game
+ * protocol and over HTTP alike. name is
+ * relative to the game directory.
+ */
+func IsAsset(name string) bool {
+	lower := strings.ToLower(name)
+	if strings.HasPrefix(lower, "logs/") || strings.HasPrefix(lower, "save/") {
+		return false
+	}
+
+	_, ok := AssetTypes[path.Ext(lower)]
+	return ok
+}
+
+/*
+ * Opens a file or directory inside a pak or pk3.
+ */
+func (pack *fsPack_t) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	name = strings.ToLower(name)
+
+	if f, ok := pack.files[name]; ok {
+		info := pack.fileInfo(f)
+
+		if pack.pk3 != nil {
+			r, err := f.zfile.Open()
+			if err != nil {
+				return nil, err
+			}
+			return &fsPackFileHandle_t{info: info, r: r, c: r}, nil
+		}
+
+		r := io.NewSectionReader(pack.pak, f.offset, int64(f.size))
+		return &fsPakFileHandle_t{SectionReader: r, info: info}, nil
+	}
+
+	entries, err := pack.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &fsPackFileInfo_t{name: path.Base(name), mtime: pack.mtime, isDir: true}
+	return &fsDirHandle_t{info: info, entries: entries}, nil
+}
+
+func (pack *fsPack_t) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	name = strings.ToLower(name)
+
+	if f, ok := pack.files[name]; ok {
+		return pack.fileInfo(f), nil
+	}
+
+	if _, err := pack.ReadDir(name); err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return &fsPackFileInfo_t{name: path.Base(name), mtime: pack.mtime, isDir: true}, nil
+}
+
+/*
+ * Packs store only files, the directories
+ * are made up from the file names.
+ */
+func (pack *fsPack_t) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	name = strings.ToLower(name)
+
+	prefix := ""
+	if name != "." {
+		prefix = name + "/"
+	}
+
+	dirs := make(map[string]bool)
+	var entries []fs.DirEntry
+
+	for fname, f := range pack.files {
+		if !strings.HasPrefix(fname, prefix) {
+			continue
 		}
+
+		rest := fname[len(prefix):]
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			if !dirs[rest[:i]] {
+				dirs[rest[:i]] = true
+				entries = append(entries, &fsPackFileInfo_t{name: rest[:i], mtime: pack.mtime, isDir: true})
+			}
+			continue
+		}
+
+		entries = append(entries, pack.fileInfo(f))
 	}
-	// if T.fs_debug {
-	log.Printf("FS_LoadFile: couldn't find '%s'.\n", path)
-	// }
-	return nil, nil
+
+	if (len(entries) == 0) && (name != ".") {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (pack *fsPack_t) fileInfo(f fsPackFile_t) *fsPackFileInfo_t {
+	info := &fsPackFileInfo_t{name: path.Base(f.name), size: int64(f.size), mtime: pack.mtime}
+	if f.zfile != nil && !f.zfile.Modified.IsZero() {
+		info.mtime = f.zfile.Modified
+	}
+	return info
 }
 
 /*
@@ -210,14 +682,14 @@ func (T *qFileSystem) loadPAK(packPath string) (*fsPack_t, error) {
 	header := dpackHeader(bfr)
 	if header.Ident != IDPAKHEADER {
 		handle.Close()
-		log.Fatalf("loadPAK: '%v' is not a pack file\n", packPath)
+		return nil, fmt.Errorf("loadPAK: '%v' is not a pack file", packPath)
 	}
 
 	numFiles := header.Dirlen / dpackfile_size
 
 	if (numFiles == 0) || (header.Dirlen < 0) || (header.Dirofs < 0) {
 		handle.Close()
-		log.Fatalf("loadPAK: '%v' is too short.", packPath)
+		return nil, fmt.Errorf("loadPAK: '%v' is too short", packPath)
 	}
 
 	if numFiles > MAX_FILES_IN_PACK {
@@ -227,28 +699,216 @@ func (T *qFileSystem) loadPAK(packPath string) (*fsPack_t, error) {
 
 	bfr = make([]byte, header.Dirlen)
 
-	files := make([]fsPackFile_t, numFiles)
+	files := make(map[string]fsPackFile_t, numFiles)
 
-	handle.ReadAt(bfr, int64(header.Dirofs))
+	if _, err := handle.ReadAt(bfr, int64(header.Dirofs)); err != nil {
+		handle.Close()
+		return nil, fmt.Errorf("loadPAK: '%v' is truncated", packPath)
+	}
 
 	/* Parse the directory. */
 	for i := 0; i < int(numFiles); i++ {
 		info := dpackFile(bfr[i*dpackfile_size:])
-		files[i].name = strings.ToLower(info.Name)
-		files[i].size = int(info.Filelen)
-		files[i].offset = int64(info.Filepos)
+
+		f := fsPackFile_t{}
+		f.name = strings.ToLower(info.Name)
+		f.size = int(info.Filelen)
+		f.offset = int64(info.Filepos)
+		files[f.name] = f
 	}
 
 	pack := fsPack_t{}
 	pack.name = packPath
 	pack.pak = handle
 	pack.files = files
+	if st, err := handle.Stat(); err == nil {
+		pack.mtime = st.ModTime()
+	}
 
 	log.Printf("Added packfile '%v' (%v files).\n", packPath, numFiles)
 
 	return &pack, nil
 }
 
+/*
+ * Takes an explicit (not game tree related) path to a pk3 file.
+ *
+ * Loads the central directory. Filenames are stored lower case,
+ * so lookups in pk3 files are case insensitive like in paks.
+ */
+func (T *qFileSystem) loadPK3(packPath string) (*fsPack_t, error) {
+	if _, err := os.Stat(packPath); err != nil {
+		return nil, nil
+	}
+
+	handle, err := zip.OpenReader(packPath)
+	if err != nil {
+		return nil, fmt.Errorf("loadPK3: '%v' is not a pack file: %v", packPath, err)
+	}
+
+	files := make(map[string]fsPackFile_t, len(handle.File))
+
+	for _, zf := range handle.File {
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+
+		f := fsPackFile_t{}
+		f.name = strings.ToLower(zf.Name)
+		f.size = int(zf.UncompressedSize64)
+		f.zfile = zf
+		files[f.name] = f
+	}
+
+	if len(files) > MAX_FILES_IN_PACK {
+		log.Printf("loadPK3: '%s' has %v > %v files\n",
+			packPath, len(files), MAX_FILES_IN_PACK)
+	}
+
+	pack := fsPack_t{}
+	pack.name = packPath
+	pack.pk3 = handle
+	pack.files = files
+	if st, err := os.Stat(packPath); err == nil {
+		pack.mtime = st.ModTime()
+	}
+
+	log.Printf("Added packfile '%v' (%v files).\n", packPath, len(files))
+
+	return &pack, nil
+}
+
+/*
+ * Loads a pak or pk3 file. A file that doesn't
+ * exist or can't be read is skipped.
+ */
+func (T *qFileSystem) loadPack(path string, format fsPackFormat_t) *fsPack_t {
+	var pack *fsPack_t
+	var err error
+
+	switch format {
+	case PAK:
+		pack, err = T.loadPAK(path)
+	case PK3:
+		pack, err = T.loadPK3(path)
+	}
+
+	if err != nil {
+		log.Printf("%v, skipped.\n", err.Error())
+		return nil
+	}
+
+	return pack
+}
+
+/*
+ * Returns the format of a pak file by it's suffix.
+ */
+func packFormat(name string) (fsPackFormat_t, bool) {
+	i := strings.LastIndexByte(name, '.')
+	if i < 0 {
+		return PAK, false
+	}
+
+	suffix := strings.ToLower(name[i+1:])
+	for _, packtype := range fs_packtypes {
+		if packtype.suffix == suffix {
+			return packtype.format, true
+		}
+	}
+
+	return PAK, false
+}
+
+/*
+ * Returns true for pak0.pak to pak99.pak (and the
+ * other suffixes), they are loaded before anything
+ * else in the directory.
+ */
+func isNumberedPak(name string) bool {
+	if !strings.HasPrefix(name, "pak") {
+		return false
+	}
+
+	i := strings.IndexByte(name, '.')
+	if i < 0 {
+		return false
+	}
+
+	if _, ok := packFormat(name); !ok {
+		return false
+	}
+
+	j, err := strconv.Atoi(name[3:i])
+	if err != nil || j < 0 || j >= maxPAKS {
+		return false
+	}
+
+	return name == fmt.Sprintf("pak%v.%v", j, name[i+1:])
+}
+
+/*
+ * Returns the non numbered pak files of a directory
+ * in the order they're added to the search path.
+ * Without an explicit list in paks.lst these are
+ * all paks sorted by type and name, with the list
+ * only the listed paks are loaded in that order.
+ */
+func (T *qFileSystem) otherPaks(dir string) []string {
+	var paks []string
+
+	if bfr, err := os.ReadFile(fmt.Sprintf("%v/%v", dir, PAKLIST)); err == nil {
+		for _, line := range strings.Split(string(bfr), "\n") {
+			line = strings.TrimSpace(line)
+			if (len(line) == 0) || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+				continue
+			}
+
+			if strings.ContainsAny(line, "/\\:") || isNumberedPak(line) {
+				log.Printf("%v: ignoring '%v'.\n", PAKLIST, line)
+				continue
+			}
+
+			paks = append(paks, line)
+		}
+
+		return paks
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	for _, packtype := range fs_packtypes {
+		var names []string
+
+		for _, e := range entries {
+			name := e.Name()
+			if e.IsDir() || isNumberedPak(name) {
+				continue
+			}
+
+			if strings.HasSuffix(strings.ToLower(name), "."+packtype.suffix) {
+				names = append(names, name)
+			}
+		}
+
+		sort.Strings(names)
+		paks = append(paks, names...)
+	}
+
+	return paks
+}
+
+/*
+ * Adds an entry in front of the search path, it
+ * overrides everything that was added before.
+ */
+func (T *qFileSystem) addSearchPath(search fsSearchPath_t) {
+	T.fs_searchPaths = append([]fsSearchPath_t{search}, T.fs_searchPaths...)
+}
+
 func (T *qFileSystem) addDirToSearchPath(dir string, create bool) error {
 
 	// Set the current directory as game directory. This
@@ -256,121 +916,197 @@ func (T *qFileSystem) addDirToSearchPath(dir string, create bool) error {
 	// be the last directory added to the search path.
 	T.fs_gamedir = dir
 
-	// 	if (create) {
-	// 		FS_CreatePath(fs_gamedir);
-	// 	}
+	if create {
+		os.MkdirAll(T.fs_gamedir, 0755)
+	}
 
 	// Add the directory itself.
 	search := fsSearchPath_t{}
-	search.path = fmt.Sprintf("%v/%v", dir, BASEDIRNAME)
-	T.fs_searchPaths = append(T.fs_searchPaths, search)
-
-	foundFile := false
+	search.name = dir
+	search.fsys = &fsLower_t{os.DirFS(dir)}
+	T.addSearchPath(search)
 
 	// We need to add numbered paks in the directory in
 	// sequence and all other paks after them. Otherwise
 	// the gamedata may break.
-	// 	for (i = 0; i < sizeof(fs_packtypes) / sizeof(fs_packtypes[0]); i++) {
-	for j := 0; j < maxPAKS; j++ {
-		path := fmt.Sprintf("%v/%v/pak%v.pak", dir, BASEDIRNAME, j)
-
-		// 			switch (fs_packtypes[i].format)
-		// 			{
-		// 				case PAK:
-		pack, err := T.loadPAK(path)
-		if err != nil {
-			return nil
+	for _, packtype := range fs_packtypes {
+		for j := 0; j < maxPAKS; j++ {
+			path := fmt.Sprintf("%v/pak%v.%v", dir, j, packtype.suffix)
+
+			pack := T.loadPack(path, packtype.format)
+			if pack == nil {
+				continue
+			}
+
+			// Numbered paks contain the official game data,
+			// files from them are never offered for download.
+			search = fsSearchPath_t{}
+			search.name = pack.name
+			search.fsys = pack
+			search.protected = packtype.format == PAK
+			T.addSearchPath(search)
 		}
+	}
 
-		// 					if (pack)
-		// 					{
-		// 						pack->isProtectedPak = true;
-		// 					}
+	// And as said above all other pak files.
+	for _, name := range T.otherPaks(dir) {
+		format, ok := packFormat(name)
+		if !ok {
+			log.Printf("%v is not a pak file, ignored.\n", name)
+			continue
+		}
 
-		// 					break;
-		// 				case PK3:
-		// 					pack = FS_LoadPK3(path);
+		pack := T.loadPack(fmt.Sprintf("%v/%v", dir, name), format)
+		if pack == nil {
+			continue
+		}
 
-		// 					if (pack)
-		// 					{
-		// 						pack->isProtectedPak = false;
-		// 					}
+		search = fsSearchPath_t{}
+		search.name = pack.name
+		search.fsys = pack
+		T.addSearchPath(search)
+	}
 
-		// 					break;
-		// 			}
+	return nil
+}
 
-		// 			if (pack == NULL)
-		// 			{
-		// 				continue;
-		// 			}
+/*
+ * Returns true if the file LoadFile would return is
+ * read from a protected (id software) pak file.
+ */
+func (T *qFileSystem) FileFromProtectedPak(path string) bool {
+	path = strings.ToLower(path)
 
-		if pack != nil {
-			search = fsSearchPath_t{}
-			search.pack = pack
-			T.fs_searchPaths = append(T.fs_searchPaths, search)
-			foundFile = true
+	if !fs.ValidPath(path) {
+		return false
+	}
+
+	for _, search := range T.fs_searchPaths {
+		if st, err := fs.Stat(search.fsys, path); err == nil && !st.IsDir() {
+			return search.protected
 		}
 	}
-	// 	}
-
-	// 	// And as said above all other pak files.
-	// 	for (i = 0; i < sizeof(fs_packtypes) / sizeof(fs_packtypes[0]); i++) {
-	// 		Com_sprintf(path, sizeof(path), "%s/*.%s", dir, fs_packtypes[i].suffix);
-
-	// 		// Nothing here, next pak type please.
-	// 		if ((list = FS_ListFiles(path, &nfiles, 0, 0)) == NULL)
-	// 		{
-	// 			continue;
-	// 		}
-
-	// 		Com_sprintf(path, sizeof(path), "%s/pak*.%s", dir, fs_packtypes[i].suffix);
-
-	// 		for (j = 0; j < nfiles - 1; j++)
-	// 		{
-	// 			// If the pak starts with the string 'pak' it's ignored.
-	// 			// This is somewhat stupid, it would be better to ignore
-	// 			// just pak%d...
-	// 			if (glob_match(path, list[j]))
-	// 			{
-	// 				continue;
-	// 			}
-
-	// 			switch (fs_packtypes[i].format)
-	// 			{
-	// 				case PAK:
-	// 					pack = FS_LoadPAK(list[j]);
-	// 					break;
-	// 				case PK3:
-	// 					pack = FS_LoadPK3(list[j]);
-	// 					break;
-	// 			}
-
-	// 			if (pack == NULL)
-	// 			{
-	// 				continue;
-	// 			}
-
-	// 			pack->isProtectedPak = false;
-
-	// 			search = Z_Malloc(sizeof(fsSearchPath_t));
-	// 			search->pack = pack;
-	// 			search->next = fs_searchPaths;
-	// 			fs_searchPaths = search;
-	// 		}
-
-	// 		FS_FreeList(list, nfiles);
-	// 	}
-	if !foundFile {
-		log.Fatalf("%v does not seem to be correct Quake2 directory\n", dir)
+	return false
+}
+
+/*
+ * Called to find where to write a file (savegames, etc).
+ */
+func (T *qFileSystem) Gamedir() string {
+	return T.fs_gamedir
+}
+
+/*
+ * Returns the filesystem of a mod. The search path of
+ * the mod is stacked above the one of baseq2, so files
+ * of the mod override the game data. The mod directory
+ * is used for writing. An empty game or baseq2 returns
+ * the baseq2 filesystem. Only mods passed to AllowGames
+ * can be used.
+ */
+func (T *qFileSystem) GameFilesystem(game string) (QFileSystem, error) {
+	if (len(game) == 0) || (game == BASEDIRNAME) {
+		return T, nil
 	}
-	return nil
+
+	if strings.HasPrefix(game, ".") || strings.ContainsAny(game, "/\\:") {
+		return nil, fmt.Errorf("invalid game directory '%v'", game)
+	}
+
+	T.fs_games_mu.Lock()
+	defer T.fs_games_mu.Unlock()
+
+	if !T.fs_allowed[game] {
+		return nil, fmt.Errorf("game directory '%v' isn't allowed", game)
+	}
+
+	if gfs, ok := T.fs_games[game]; ok {
+		return gfs, nil
+	}
+
+	/* the mod may ship loose files only,
+	   being allowed is enough */
+	dir := fmt.Sprintf("%v/%v", T.fs_basedir, game)
+	if st, err := os.Stat(dir); err != nil || !st.IsDir() {
+		return nil, fmt.Errorf("'%v' isn't a game directory", dir)
+	}
+
+	gfs := &qFileSystem{}
+	gfs.fs_basedir = T.fs_basedir
+	gfs.fs_debug = T.fs_debug
+	gfs.fs_searchPaths = append([]fsSearchPath_t{}, T.fs_searchPaths...)
+	if err := gfs.addDirToSearchPath(dir, false); err != nil {
+		return nil, err
+	}
+
+	if T.fs_games == nil {
+		T.fs_games = make(map[string]*qFileSystem)
+	}
+	T.fs_games[game] = gfs
+
+	log.Printf("Added game directory '%v'.\n", dir)
+	return gfs, nil
+}
+
+/*
+ * Sets the mods GameFilesystem may return,
+ * e.g. the mods of the configured games.
+ * Empty names are ignored.
+ */
+func (T *qFileSystem) AllowGames(games ...string) {
+	T.fs_games_mu.Lock()
+	defer T.fs_games_mu.Unlock()
+
+	T.fs_allowed = make(map[string]bool)
+	for _, game := range games {
+		if len(game) > 0 {
+			T.fs_allowed[game] = true
+		}
+	}
+}
+
+/*
+ * Adds an arbitrary file system (e.g. os.DirFS, a
+ * zip.Reader, an embed.FS or a fstest.MapFS) in front
+ * of the search path. Its files override everything
+ * added before, names in it are case insensitive.
+ */
+func (T *qFileSystem) AddLayer(name string, fsys fs.FS) {
+	search := fsSearchPath_t{}
+	search.name = name
+	search.fsys = &fsLower_t{fsys}
+	T.addSearchPath(search)
 }
 
 // --------
 
+/*
+ * Creates a filesystem from the given layers, the
+ * last one has the highest priority. Writes go to
+ * gamedir. Mainly used to run the server without
+ * real game data.
+ */
+func CreateFilesystem(gamedir string, debug bool, layers ...fs.FS) QFileSystem {
+	q := &qFileSystem{}
+	q.fs_gamedir = gamedir
+	q.fs_debug = debug
+
+	for i, l := range layers {
+		q.AddLayer(fmt.Sprintf("layer%v", i), l)
+	}
+
+	return q
+}
+
 func InitFilesystem(basepath string, debug bool) QFileSystem {
 	q := &qFileSystem{}
+	q.fs_basedir = basepath
 	q.fs_debug = debug
-	q.addDirToSearchPath(basepath, false)
+	q.addDirToSearchPath(fmt.Sprintf("%v/%v", basepath, BASEDIRNAME), false)
+
+	if len(q.fs_searchPaths) < 2 {
+		log.Fatalf("%v does not seem to be correct Quake2 directory\n", basepath)
+	}
+
 	return q
 }
@@ -0,0 +1,305 @@
+/*
+ * Copyright (C) 1997-2001 Id Software, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *
+ * See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place - Suite 330, Boston, MA
+ * 02111-1307, USA.
+ *
+ * =======================================================================
+ *
+ * Tests of the search path, built from in-memory layers.
+ *
+ * =======================================================================
+ */
+package shared
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+/*
+ * base is like pak0.pak, addon overrides some
+ * of its files and adds new ones.
+ */
+func testFilesystem() QFileSystem {
+	base := fstest.MapFS{
+		"maps/base1.bsp":      {Data: []byte("base1")},
+		"maps/base2.bsp":      {Data: []byte("base2")},
+		"pics/colormap.pcx":   {Data: []byte("colormap")},
+		"sound/misc/tele.wav": {Data: []byte("tele")},
+	}
+	addon := fstest.MapFS{
+		"maps/base2.bsp":      {Data: []byte("addon base2")},
+		"maps/q2dm1.bsp":      {Data: []byte("q2dm1")},
+		"sound/misc/menu.wav": {Data: []byte("menu")},
+	}
+
+	return CreateFilesystem("", false, base, addon)
+}
+
+func TestFilesystemPriority(t *testing.T) {
+	fsys := testFilesystem()
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"maps/base1.bsp", "base1"},
+		{"maps/base2.bsp", "addon base2"},
+		{"maps/q2dm1.bsp", "q2dm1"},
+		{"pics/colormap.pcx", "colormap"},
+	}
+
+	for _, tt := range tests {
+		data, err := fs.ReadFile(fsys, tt.name)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if string(data) != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, data, tt.want)
+		}
+	}
+
+	/* a layer added later overrides everything */
+	fsys.(*qFileSystem).AddLayer("patch", fstest.MapFS{
+		"maps/base1.bsp": {Data: []byte("patched base1")},
+	})
+	if data, _ := fsys.LoadFile("maps/base1.bsp"); string(data) != "patched base1" {
+		t.Errorf("maps/base1.bsp = %q after AddLayer", data)
+	}
+
+	/* LoadFile returns nil for missing files */
+	if data, err := fsys.LoadFile("maps/missing.bsp"); (data != nil) || (err != nil) {
+		t.Errorf("LoadFile of a missing file = %q, %v", data, err)
+	}
+}
+
+func TestFilesystemCase(t *testing.T) {
+	fsys := testFilesystem()
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"MAPS/BASE1.BSP", "base1"},
+		{"Maps/Base2.bsp", "addon base2"},
+		{"sound/MISC/Tele.wav", "tele"},
+	}
+
+	for _, tt := range tests {
+		data, err := fsys.LoadFile(tt.name)
+		if err != nil || string(data) != tt.want {
+			t.Errorf("LoadFile(%s) = %q, %v, want %q", tt.name, data, err, tt.want)
+		}
+
+		if _, err := fsys.Stat(tt.name); err != nil {
+			t.Errorf("Stat(%s): %v", tt.name, err)
+		}
+	}
+
+	if _, err := fsys.Stat("maps/missing.bsp"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat of a missing file: %v", err)
+	}
+	if _, err := fsys.Stat("../maps/base1.bsp"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Stat of an invalid path: %v", err)
+	}
+}
+
+func TestFilesystemReadDir(t *testing.T) {
+	fsys := testFilesystem()
+
+	tests := []struct {
+		dir  string
+		want []string
+	}{
+		{".", []string{"maps", "pics", "sound"}},
+		{"maps", []string{"base1.bsp", "base2.bsp", "q2dm1.bsp"}},
+		{"sound/misc", []string{"menu.wav", "tele.wav"}},
+		{"SOUND/Misc", []string{"menu.wav", "tele.wav"}},
+	}
+
+	for _, tt := range tests {
+		entries, err := fsys.ReadDir(tt.dir)
+		if err != nil {
+			t.Errorf("ReadDir(%s): %v", tt.dir, err)
+			continue
+		}
+
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("ReadDir(%s) = %v, want %v", tt.dir, names, tt.want)
+		}
+	}
+
+	/* the overridden file is the one of the addon */
+	entries, _ := fsys.ReadDir("maps")
+	for _, e := range entries {
+		if e.Name() != "base2.bsp" {
+			continue
+		}
+		if info, err := e.Info(); err != nil || info.Size() != int64(len("addon base2")) {
+			t.Errorf("base2.bsp has the wrong size")
+		}
+	}
+
+	if _, err := fsys.ReadDir("textures"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadDir of a missing directory: %v", err)
+	}
+
+	maps := ListMaps(fsys)
+	if want := []string{"base1", "base2", "q2dm1"}; !reflect.DeepEqual(maps, want) {
+		t.Errorf("ListMaps = %v, want %v", maps, want)
+	}
+}
+
+func TestFilesystemFS(t *testing.T) {
+	if err := fstest.TestFS(testFilesystem(), "maps/base1.bsp", "maps/base2.bsp",
+		"maps/q2dm1.bsp", "pics/colormap.pcx", "sound/misc/tele.wav",
+		"sound/misc/menu.wav"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsAsset(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"maps/base1.bsp", true},
+		{"players/male/tris.MD2", true},
+		{"sound/misc/tele.wav", true},
+		{"config.cfg", false},
+		{"listip.cfg", false},
+		{"logs/single1/qconsole.log", false},
+		{"save/single1/save0/server.ssv", false},
+		{"Save/single1/game.ssv", false},
+		{"save/single1/current/base1.bsp", false},
+		{"maps/base1", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsAsset(tt.name); got != tt.want {
+			t.Errorf("IsAsset(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+/*
+ * Directories and other layers may have names
+ * in any case, they are seen in lower case.
+ */
+func TestFilesystemMixedCase(t *testing.T) {
+	fsys := testFilesystem()
+	fsys.(*qFileSystem).AddLayer("mod", fstest.MapFS{
+		"Maps/Q2CTF1.bsp":         {Data: []byte("q2ctf1")},
+		"players/Male/Tris.MD2":   {Data: []byte("tris")},
+		"players/Male/grunt.pcx":  {Data: []byte("grunt")},
+		"sound/Misc/TELE.wav":     {Data: []byte("mod tele")},
+		"textures/e1u1/Floor.wal": {Data: []byte("floor")},
+	})
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"maps/q2ctf1.bsp", "q2ctf1"},
+		{"MAPS/Q2CTF1.BSP", "q2ctf1"},
+		{"players/male/tris.md2", "tris"},
+		{"players/male/grunt.pcx", "grunt"},
+		{"sound/misc/tele.wav", "mod tele"},
+		{"maps/base1.bsp", "base1"},
+	}
+
+	for _, tt := range tests {
+		data, err := fsys.LoadFile(tt.name)
+		if err != nil || string(data) != tt.want {
+			t.Errorf("LoadFile(%s) = %q, %v, want %q", tt.name, data, err, tt.want)
+		}
+
+		if info, err := fsys.Stat(tt.name); err != nil {
+			t.Errorf("Stat(%s): %v", tt.name, err)
+		} else if info.Name() != strings.ToLower(path.Base(tt.name)) {
+			t.Errorf("Stat(%s).Name() = %s", tt.name, info.Name())
+		}
+	}
+
+	/* every listed entry can be opened */
+	entries, err := fsys.ReadDir("players/male")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+		if _, err := fsys.Open("players/male/" + e.Name()); err != nil {
+			t.Errorf("Open of listed %s: %v", e.Name(), err)
+		}
+	}
+	if want := []string{"grunt.pcx", "tris.md2"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ReadDir(players/male) = %v, want %v", names, want)
+	}
+
+	maps := ListMaps(fsys)
+	if want := []string{"base1", "base2", "q2ctf1", "q2dm1"}; !reflect.DeepEqual(maps, want) {
+		t.Errorf("ListMaps = %v, want %v", maps, want)
+	}
+
+	if err := fstest.TestFS(fsys, "maps/q2ctf1.bsp", "players/male/tris.md2",
+		"sound/misc/tele.wav", "textures/e1u1/floor.wal"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGameFilesystem(t *testing.T) {
+	basedir := t.TempDir()
+	if err := os.MkdirAll(basedir+"/mappack/maps", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(basedir+"/mappack/maps/Mine.bsp", []byte("mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(basedir+"/other", 0755)
+
+	fsys := testFilesystem().(*qFileSystem)
+	fsys.fs_basedir = basedir
+	fsys.AllowGames("mappack", "missing")
+
+	/* a mod of loose files, without paks */
+	gfs, err := fsys.GameFilesystem("mappack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := gfs.LoadFile("maps/mine.bsp"); string(data) != "mine" {
+		t.Errorf("maps/mine.bsp of the mod = %q", data)
+	}
+	if data, _ := gfs.LoadFile("maps/base1.bsp"); string(data) != "base1" {
+		t.Errorf("maps/base1.bsp through the mod = %q", data)
+	}
+
+	for _, game := range []string{"other", "missing", "../mappack", ".hidden"} {
+		if _, err := fsys.GameFilesystem(game); err == nil {
+			t.Errorf("GameFilesystem(%s) didn't fail", game)
+		}
+	}
+}
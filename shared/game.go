@@ -65,6 +65,7 @@ type Gclient_s interface {
 	// int ping;
 	Ps() *Player_state_t
 	Ping() int
+	SetPing(v int)
 	/* the game dll can add anything it wants
 	after  this point in the structure */
 }
@@ -73,6 +74,7 @@ type Edict_s interface {
 	S() *Entity_state_t
 	Client() Gclient_s
 	Inuse() bool
+	SetInuse(v bool)
 	Linkcount() int
 	SetLinkcount(v int)
 
@@ -108,14 +110,14 @@ type Edict_s interface {
 /* functions provided by the main engine */
 type Game_import_t interface {
 	/* special messages */
-	// void (*bprintf)(int printlevel, char *fmt, ...);
+	Bprintf(printlevel int, format string, a ...interface{})
 	Dprintf(format string, a ...interface{})
-	// void (*cprintf)(edict_t *ent, int printlevel, char *fmt, ...);
-	// void (*centerprintf)(edict_t *ent, char *fmt, ...);
-	// void (*sound)(edict_t *ent, int channel, int soundindex, float volume,
-	// 		float attenuation, float timeofs);
-	// void (*positioned_sound)(vec3_t origin, edict_t *ent, int channel,
-	// 		int soundinedex, float volume, float attenuation, float timeofs);
+	Cprintf(ent Edict_s, printlevel int, format string, a ...interface{})
+	Centerprintf(ent Edict_s, format string, a ...interface{})
+	Sound(ent Edict_s, channel, soundindex int, volume,
+		attenuation, timeofs float32)
+	Positioned_sound(origin []float32, ent Edict_s, channel,
+		soundindex int, volume, attenuation, timeofs float32)
 
 	/* config strings hold all the index strings, the lightstyles,
 	and misc data like the sky definition and cdtrack.
@@ -151,7 +153,7 @@ type Game_import_t interface {
 
 	// /* network messaging */
 	Multicast(origin []float32, to Multicast_t)
-	// void (*unicast)(edict_t *ent, qboolean reliable);
+	Unicast(ent Edict_s, reliable bool)
 	// void (*WriteChar)(int c);
 	WriteByte(c int)
 	WriteShort(c int)
@@ -172,16 +174,18 @@ type Game_import_t interface {
 	CvarSet(var_name, value string) *CvarT
 	CvarForceSet(var_name, value string) *CvarT
 
-	// /* ClientCommand and ServerCommand parameter access */
-	// int (*argc)(void);
-	// char *(*argv)(int n);
-	// char *(*args)(void); /* concatenation of all argv >= 1 */
+	/* ClientCommand and ServerCommand parameter access */
+	Argc() int
+	Argv(n int) string
+	Args() string /* concatenation of all argv >= 1 */
 
-	// /* add commands to the server console as if
-	//    they were typed in for map changing, etc */
-	// void (*AddCommandString)(char *text);
+	/* add commands to the server console as if
+	   they were typed in for map changing, etc */
+	AddCommandString(text string)
 
 	// void (*DebugGraph)(float value, int color);
+
+	Gamedir() string /* directory files of the game are written to */
 }
 
 /* functions exported by the game subsystem */
@@ -197,33 +201,33 @@ type Game_export_t interface {
 	/* each new level entered will cause a call to SpawnEntities */
 	SpawnEntities(mapname, entstring, spawnpoint string) error
 
-	// /* Read/Write Game is for storing persistant cross level information
-	//    about the world state and the clients.
-	//    WriteGame is called every time a level is exited.
-	//    ReadGame is called on a loadgame. */
-	// void (*WriteGame)(char *filename, qboolean autosave);
-	// void (*ReadGame)(char *filename);
+	/* Read/Write Game is for storing persistant cross level information
+	   about the world state and the clients.
+	   WriteGame is called every time a level is exited.
+	   ReadGame is called on a loadgame. */
+	WriteGame(filename string, autosave bool) error
+	ReadGame(filename string) error
 
-	// /* ReadLevel is called after the default
-	//    map information has been loaded with
-	//    SpawnEntities */
-	// void (*WriteLevel)(char *filename);
-	// void (*ReadLevel)(char *filename);
+	/* ReadLevel is called after the default
+	   map information has been loaded with
+	   SpawnEntities */
+	WriteLevel(filename string) error
+	ReadLevel(filename string) error
 
 	ClientConnect(ent Edict_s, userinfo string) bool
 	ClientBegin(ent Edict_s) error
-	// void (*ClientUserinfoChanged)(edict_t *ent, char *userinfo);
-	// void (*ClientDisconnect)(edict_t *ent);
+	ClientUserinfoChanged(ent Edict_s, userinfo string)
+	ClientDisconnect(ent Edict_s)
 	ClientCommand(ent Edict_s, args []string)
 	ClientThink(ent Edict_s, cmd *Usercmd_t)
 
 	RunFrame() error
 
-	// /* ServerCommand will be called when an "sv <command>"
-	//    command is issued on the  server console. The game can
-	//    issue gi.argc() / gi.argv() commands to get the rest
-	//    of the parameters */
-	// void (*ServerCommand)(void);
+	/* ServerCommand will be called when an "sv <command>"
+	   command is issued on the  server console. The game can
+	   issue gi.argc() / gi.argv() commands to get the rest
+	   of the parameters */
+	ServerCommand()
 
 	/* global variables shared between game and server */
 
@@ -0,0 +1,671 @@
+/*
+ * Copyright (C) 1997-2001 Id Software, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *
+ * See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place - Suite 330, Boston, MA
+ * 02111-1307, USA.
+ *
+ * =======================================================================
+ *
+ * Export of .md2 models to binary glTF 2.0 (.glb). Every frame of the
+ * model becomes a morph target, frames with a common name prefix
+ * ("run1" to "run6") become an animation playing at 10 frames per
+ * second like on the server. .sp2 sprites become a quad per frame.
+ *
+ * =======================================================================
+ */
+package shared
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+type gltfAsset struct {
+	Version   string `json:"version"`
+	Generator string `json:"generator,omitempty"`
+}
+
+type gltfBuffer struct {
+	ByteLength int `json:"byteLength"`
+}
+
+type gltfBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	Target     int `json:"target,omitempty"`
+}
+
+type gltfAccessor struct {
+	BufferView    int       `json:"bufferView"`
+	ComponentType int       `json:"componentType"`
+	Count         int       `json:"count"`
+	Type          string    `json:"type"`
+	Min           []float32 `json:"min,omitempty"`
+	Max           []float32 `json:"max,omitempty"`
+}
+
+type gltfPrimitive struct {
+	Attributes map[string]int   `json:"attributes"`
+	Indices    int              `json:"indices"`
+	Material   *int             `json:"material,omitempty"`
+	Targets    []map[string]int `json:"targets,omitempty"`
+}
+
+type gltfMesh struct {
+	Name       string          `json:"name,omitempty"`
+	Primitives []gltfPrimitive `json:"primitives"`
+	Weights    []float32       `json:"weights,omitempty"`
+	Extras     interface{}     `json:"extras,omitempty"`
+}
+
+type gltfNode struct {
+	Name  string    `json:"name,omitempty"`
+	Mesh  int       `json:"mesh"`
+	Scale []float32 `json:"scale,omitempty"`
+}
+
+type gltfScene struct {
+	Nodes []int `json:"nodes"`
+}
+
+type gltfTextureInfo struct {
+	Index int `json:"index"`
+}
+
+type gltfPBR struct {
+	BaseColorTexture *gltfTextureInfo `json:"baseColorTexture,omitempty"`
+	MetallicFactor   float32          `json:"metallicFactor"`
+	RoughnessFactor  float32          `json:"roughnessFactor"`
+}
+
+type gltfMaterial struct {
+	Name                 string  `json:"name,omitempty"`
+	PbrMetallicRoughness gltfPBR `json:"pbrMetallicRoughness"`
+	AlphaMode            string  `json:"alphaMode,omitempty"`
+}
+
+type gltfImage struct {
+	Name       string `json:"name,omitempty"`
+	BufferView int    `json:"bufferView"`
+	MimeType   string `json:"mimeType"`
+}
+
+type gltfTexture struct {
+	Sampler int `json:"sampler"`
+	Source  int `json:"source"`
+}
+
+type gltfSampler struct {
+	MagFilter int `json:"magFilter"`
+	MinFilter int `json:"minFilter"`
+}
+
+type gltfAnimationChannelTarget struct {
+	Node int    `json:"node"`
+	Path string `json:"path"`
+}
+
+type gltfAnimationChannel struct {
+	Sampler int                        `json:"sampler"`
+	Target  gltfAnimationChannelTarget `json:"target"`
+}
+
+type gltfAnimationSampler struct {
+	Input         int    `json:"input"`
+	Output        int    `json:"output"`
+	Interpolation string `json:"interpolation"`
+}
+
+type gltfAnimation struct {
+	Name     string                 `json:"name"`
+	Channels []gltfAnimationChannel `json:"channels"`
+	Samplers []gltfAnimationSampler `json:"samplers"`
+}
+
+type gltfDocument struct {
+	Asset       gltfAsset        `json:"asset"`
+	Scene       int              `json:"scene"`
+	Scenes      []gltfScene      `json:"scenes"`
+	Nodes       []gltfNode       `json:"nodes"`
+	Meshes      []gltfMesh       `json:"meshes"`
+	Materials   []gltfMaterial   `json:"materials,omitempty"`
+	Textures    []gltfTexture    `json:"textures,omitempty"`
+	Images      []gltfImage      `json:"images,omitempty"`
+	Samplers    []gltfSampler    `json:"samplers,omitempty"`
+	Animations  []gltfAnimation  `json:"animations,omitempty"`
+	Accessors   []gltfAccessor   `json:"accessors"`
+	BufferViews []gltfBufferView `json:"bufferViews"`
+	Buffers     []gltfBuffer     `json:"buffers"`
+}
+
+const (
+	gltf_ARRAY_BUFFER         = 34962
+	gltf_ELEMENT_ARRAY_BUFFER = 34963
+	gltf_UNSIGNED_SHORT       = 5123
+	gltf_UNSIGNED_INT         = 5125
+	gltf_FLOAT                = 5126
+	gltf_NEAREST              = 9728
+)
+
+/*
+ * Collects the binary data of the document,
+ * every part is 4 byte aligned.
+ */
+type gltfBuilder struct {
+	doc gltfDocument
+	bin bytes.Buffer
+}
+
+func (b *gltfBuilder) addView(data []byte, target int) int {
+	for b.bin.Len()%4 != 0 {
+		b.bin.WriteByte(0)
+	}
+
+	b.doc.BufferViews = append(b.doc.BufferViews, gltfBufferView{0, b.bin.Len(), len(data), target})
+	b.bin.Write(data)
+	return len(b.doc.BufferViews) - 1
+}
+
+func (b *gltfBuilder) addFloats(values []float32, typ string, withBounds bool) int {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, values)
+
+	comps := map[string]int{"SCALAR": 1, "VEC2": 2, "VEC3": 3}[typ]
+	acc := gltfAccessor{}
+	acc.BufferView = b.addView(buf.Bytes(), 0)
+	acc.ComponentType = gltf_FLOAT
+	acc.Count = len(values) / comps
+	acc.Type = typ
+
+	if withBounds {
+		acc.Min = make([]float32, comps)
+		acc.Max = make([]float32, comps)
+		for c := 0; c < comps; c++ {
+			acc.Min[c] = float32(math.Inf(1))
+			acc.Max[c] = float32(math.Inf(-1))
+		}
+		for i, v := range values {
+			c := i % comps
+			if v < acc.Min[c] {
+				acc.Min[c] = v
+			}
+			if v > acc.Max[c] {
+				acc.Max[c] = v
+			}
+		}
+	}
+
+	b.doc.Accessors = append(b.doc.Accessors, acc)
+	return len(b.doc.Accessors) - 1
+}
+
+func (b *gltfBuilder) addIndices(indices []uint32, numverts int) int {
+	var ibuf bytes.Buffer
+	itype := gltf_UNSIGNED_INT
+	if numverts < 65536 {
+		itype = gltf_UNSIGNED_SHORT
+		for _, i := range indices {
+			binary.Write(&ibuf, binary.LittleEndian, uint16(i))
+		}
+	} else {
+		binary.Write(&ibuf, binary.LittleEndian, indices)
+	}
+
+	b.doc.Accessors = append(b.doc.Accessors, gltfAccessor{
+		BufferView:    b.addView(ibuf.Bytes(), gltf_ELEMENT_ARRAY_BUFFER),
+		ComponentType: itype,
+		Count:         len(indices),
+		Type:          "SCALAR",
+	})
+	return len(b.doc.Accessors) - 1
+}
+
+/*
+ * Adds an unlit looking material with the PNG
+ * as texture, palette index 255 is transparent.
+ */
+func (b *gltfBuilder) addMaterial(name string, png []byte) int {
+	if len(b.doc.Samplers) == 0 {
+		b.doc.Samplers = []gltfSampler{{gltf_NEAREST, gltf_NEAREST}}
+	}
+
+	b.doc.Images = append(b.doc.Images, gltfImage{name, b.addView(png, 0), "image/png"})
+	b.doc.Textures = append(b.doc.Textures, gltfTexture{0, len(b.doc.Images) - 1})
+	b.doc.Materials = append(b.doc.Materials, gltfMaterial{
+		Name: name,
+		PbrMetallicRoughness: gltfPBR{
+			BaseColorTexture: &gltfTextureInfo{len(b.doc.Textures) - 1},
+			MetallicFactor:   0,
+			RoughnessFactor:  1,
+		},
+		AlphaMode: "MASK",
+	})
+	return len(b.doc.Materials) - 1
+}
+
+/*
+ * Writes the document as binary glTF, a
+ * header, the JSON chunk and the BIN chunk.
+ */
+func (b *gltfBuilder) glb() ([]byte, error) {
+	for b.bin.Len()%4 != 0 {
+		b.bin.WriteByte(0)
+	}
+	b.doc.Buffers = []gltfBuffer{{b.bin.Len()}}
+
+	js, err := json.Marshal(b.doc)
+	if err != nil {
+		return nil, err
+	}
+	for len(js)%4 != 0 {
+		js = append(js, ' ')
+	}
+
+	var out bytes.Buffer
+	binary.Write(&out, binary.LittleEndian, []uint32{0x46546C67, 2, uint32(12 + 8 + len(js) + 8 + b.bin.Len())})
+	binary.Write(&out, binary.LittleEndian, []uint32{uint32(len(js)), 0x4E4F534A})
+	out.Write(js)
+	binary.Write(&out, binary.LittleEndian, []uint32{uint32(b.bin.Len()), 0x004E4942})
+	out.Write(b.bin.Bytes())
+	return out.Bytes(), nil
+}
+
+/*
+ * Frames are named like "stand01" or "pain301",
+ * the animation is the name without the number.
+ */
+func md2AnimationName(frame string) string {
+	name := strings.TrimRight(frame, "0123456789")
+	if len(name) == 0 {
+		return frame
+	}
+	return name
+}
+
+/*
+ * Quake is Z up with X forward, glTF is Y up
+ * with Z forward.
+ */
+func md2Position(frame *Daliasframe_t, v Dtrivertx_t) [3]float32 {
+	var p [3]float32
+	for i := 0; i < 3; i++ {
+		p[i] = float32(v.V[i])*frame.Scale[i] + frame.Translate[i]
+	}
+	return [3]float32{p[1], p[2], p[0]}
+}
+
+func md2Normal(v Dtrivertx_t) [3]float32 {
+	if int(v.Lightnormalindex) >= len(bytedirs) {
+		return [3]float32{0, 1, 0}
+	}
+	n := bytedirs[v.Lightnormalindex]
+	return [3]float32{n[1], n[2], n[0]}
+}
+
+/*
+ * Returns the skin names of a .md2 model
+ */
+func MD2Skins(data []byte) ([]string, error) {
+	if len(data) < Dmdl_size {
+		return nil, fmt.Errorf("MD2 file is too short")
+	}
+
+	hdr := Dmdl(data)
+	if (hdr.Num_skins < 0) || (hdr.Ofs_skins < 0) ||
+		(int(hdr.Ofs_skins)+int(hdr.Num_skins)*MAX_SKINNAME > len(data)) {
+		return nil, fmt.Errorf("MD2 file has bad skins")
+	}
+
+	skins := make([]string, hdr.Num_skins)
+	for i := range skins {
+		skins[i] = ReadString(data[int(hdr.Ofs_skins)+i*MAX_SKINNAME:], MAX_SKINNAME)
+	}
+	return skins, nil
+}
+
+/*
+ * Converts a .md2 model to binary glTF. The skins
+ * are passed as PNG, in the order of the skin list
+ * of the model. A skin that couldn't be loaded may
+ * be nil, the model is exported without it.
+ */
+func MD2ToGLB(data []byte, skins [][]byte) ([]byte, error) {
+	if len(data) < Dmdl_size {
+		return nil, fmt.Errorf("MD2 file is too short")
+	}
+
+	hdr := Dmdl(data)
+
+	if hdr.Ident != IDALIASHEADER {
+		return nil, fmt.Errorf("MD2 file has wrong ident")
+	}
+
+	if hdr.Version != ALIAS_VERSION {
+		return nil, fmt.Errorf("MD2 file has wrong version number (%v should be %v)",
+			hdr.Version, ALIAS_VERSION)
+	}
+
+	if (hdr.Skinwidth <= 0) || (hdr.Skinheight <= 0) ||
+		(hdr.Num_xyz <= 0) || (hdr.Num_xyz > MAX_VERTS) ||
+		(hdr.Num_st <= 0) || (hdr.Num_tris <= 0) || (hdr.Num_tris > MAX_TRIANGLES) ||
+		(hdr.Num_frames <= 0) || (hdr.Num_frames > MAX_FRAMES) ||
+		(hdr.Framesize < daliasframe_size+hdr.Num_xyz*Dtrivertx_size) ||
+		((hdr.Framesize-daliasframe_size)%Dtrivertx_size != 0) {
+		return nil, fmt.Errorf("MD2 file has bad header")
+	}
+
+	if (hdr.Ofs_st < 0) || (int(hdr.Ofs_st)+int(hdr.Num_st)*Dstvert_size > len(data)) ||
+		(hdr.Ofs_tris < 0) || (int(hdr.Ofs_tris)+int(hdr.Num_tris)*Dtriangle_size > len(data)) ||
+		(hdr.Ofs_frames < 0) || (int(hdr.Ofs_frames)+int(hdr.Num_frames)*int(hdr.Framesize) > len(data)) {
+		return nil, fmt.Errorf("MD2 file is too short")
+	}
+
+	frames := make([]Daliasframe_t, hdr.Num_frames)
+	for i := range frames {
+		frames[i] = Daliasframe(data[int(hdr.Ofs_frames)+i*int(hdr.Framesize):], int(hdr.Framesize))
+	}
+
+	/* a glTF vertex is a pair of a position and
+	   a texture coordinate, md2 indexes them
+	   separately */
+	type md2Vertex struct {
+		xyz, st int16
+	}
+	vertmap := make(map[md2Vertex]int)
+	var verts []md2Vertex
+	var indices []uint32
+
+	for i := 0; i < int(hdr.Num_tris); i++ {
+		tri := Dtriangle(data[int(hdr.Ofs_tris)+i*Dtriangle_size:])
+
+		/* md2 triangles are clockwise */
+		for _, k := range []int{0, 2, 1} {
+			v := md2Vertex{tri.Index_xyz[k], tri.Index_st[k]}
+			if (v.xyz < 0) || (int32(v.xyz) >= hdr.Num_xyz) ||
+				(v.st < 0) || (int32(v.st) >= hdr.Num_st) {
+				return nil, fmt.Errorf("MD2 file has bad triangle %v", i)
+			}
+
+			idx, ok := vertmap[v]
+			if !ok {
+				idx = len(verts)
+				vertmap[v] = idx
+				verts = append(verts, v)
+			}
+			indices = append(indices, uint32(idx))
+		}
+	}
+
+	b := &gltfBuilder{}
+	b.doc.Asset = gltfAsset{"2.0", "quake2srv"}
+
+	/* the first frame is the base mesh */
+	positions := make([]float32, 0, len(verts)*3)
+	normals := make([]float32, 0, len(verts)*3)
+	texcoords := make([]float32, 0, len(verts)*2)
+	for _, v := range verts {
+		p := md2Position(&frames[0], frames[0].Verts[v.xyz])
+		n := md2Normal(frames[0].Verts[v.xyz])
+		st := Dstvert(data[int(hdr.Ofs_st)+int(v.st)*Dstvert_size:])
+		positions = append(positions, p[:]...)
+		normals = append(normals, n[:]...)
+		texcoords = append(texcoords, float32(st.S)/float32(hdr.Skinwidth), float32(st.T)/float32(hdr.Skinheight))
+	}
+
+	prim := gltfPrimitive{}
+	prim.Attributes = map[string]int{
+		"POSITION":   b.addFloats(positions, "VEC3", true),
+		"NORMAL":     b.addFloats(normals, "VEC3", false),
+		"TEXCOORD_0": b.addFloats(texcoords, "VEC2", false),
+	}
+
+	prim.Indices = b.addIndices(indices, len(verts))
+
+	/* every frame is a morph target, relative
+	   to the first frame */
+	names := make([]string, len(frames))
+	for f := range frames {
+		names[f] = frames[f].Name
+		dpos := make([]float32, 0, len(verts)*3)
+		dnorm := make([]float32, 0, len(verts)*3)
+		for j, v := range verts {
+			p := md2Position(&frames[f], frames[f].Verts[v.xyz])
+			n := md2Normal(frames[f].Verts[v.xyz])
+			for c := 0; c < 3; c++ {
+				dpos = append(dpos, p[c]-positions[j*3+c])
+				dnorm = append(dnorm, n[c]-normals[j*3+c])
+			}
+		}
+		prim.Targets = append(prim.Targets, map[string]int{
+			"POSITION": b.addFloats(dpos, "VEC3", true),
+			"NORMAL":   b.addFloats(dnorm, "VEC3", false),
+		})
+	}
+
+	/* skins */
+	skinnames, _ := MD2Skins(data)
+	for i, png := range skins {
+		if png == nil {
+			continue
+		}
+		name := ""
+		if i < len(skinnames) {
+			name = skinnames[i]
+		}
+		b.addMaterial(name, png)
+	}
+	if len(b.doc.Materials) > 0 {
+		m := 0
+		prim.Material = &m
+	}
+
+	mesh := gltfMesh{}
+	mesh.Primitives = []gltfPrimitive{prim}
+	mesh.Weights = make([]float32, len(frames))
+	mesh.Extras = map[string]interface{}{"targetNames": names}
+	b.doc.Meshes = []gltfMesh{mesh}
+	b.doc.Nodes = []gltfNode{{Name: "model"}}
+	b.doc.Scenes = []gltfScene{{[]int{0}}}
+
+	/* animations, one keyframe per frame at 10 fps */
+	for start := 0; start < len(frames); {
+		name := md2AnimationName(frames[start].Name)
+		end := start + 1
+		for end < len(frames) && md2AnimationName(frames[end].Name) == name {
+			end++
+		}
+
+		times := make([]float32, 0, end-start)
+		weights := make([]float32, 0, (end-start)*len(frames))
+		for f := start; f < end; f++ {
+			times = append(times, float32(f-start)*0.1)
+			w := make([]float32, len(frames))
+			w[f] = 1
+			weights = append(weights, w...)
+		}
+
+		anim := gltfAnimation{}
+		anim.Name = name
+		anim.Samplers = []gltfAnimationSampler{{
+			Input:         b.addFloats(times, "SCALAR", true),
+			Output:        b.addFloats(weights, "SCALAR", false),
+			Interpolation: "LINEAR",
+		}}
+		anim.Channels = []gltfAnimationChannel{{0, gltfAnimationChannelTarget{0, "weights"}}}
+		b.doc.Animations = append(b.doc.Animations, anim)
+
+		start = end
+	}
+
+	return b.glb()
+}
+
+/*
+ * Returns the frame pics of a .sp2 sprite
+ */
+func SP2Frames(data []byte) ([]string, error) {
+	spr, err := loadSP2(data)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(spr.Frames))
+	for i := range spr.Frames {
+		names[i] = spr.Frames[i].Name
+	}
+	return names, nil
+}
+
+func loadSP2(data []byte) (*Dsprite_t, error) {
+	if len(data) < 3*4 {
+		return nil, fmt.Errorf("SP2 file is too short")
+	}
+
+	hdr := Dsprite_t{}
+	hdr.Ident = ReadInt32(data[0*4:])
+	hdr.Version = ReadInt32(data[1*4:])
+	hdr.Numframes = ReadInt32(data[2*4:])
+
+	if hdr.Ident != IDSPRITEHEADER {
+		return nil, fmt.Errorf("SP2 file has wrong ident")
+	}
+
+	if hdr.Version != SPRITE_VERSION {
+		return nil, fmt.Errorf("SP2 file has wrong version number (%v should be %v)",
+			hdr.Version, SPRITE_VERSION)
+	}
+
+	if (hdr.Numframes <= 0) || (hdr.Numframes > MAX_MD2SKINS) ||
+		(3*4+int(hdr.Numframes)*Dsprframe_size > len(data)) {
+		return nil, fmt.Errorf("SP2 file has bad number of frames (%v)", hdr.Numframes)
+	}
+
+	spr := Dsprite(data)
+	for i := range spr.Frames {
+		f := &spr.Frames[i]
+		if (f.Width <= 0) || (f.Height <= 0) || (f.Width > 4096) || (f.Height > 4096) {
+			return nil, fmt.Errorf("SP2 file has bad frame %v", i)
+		}
+	}
+	return &spr, nil
+}
+
+/*
+ * Converts a .sp2 sprite to binary glTF. Every
+ * frame is a textured quad in its own node, the
+ * origin of the frame is at the node origin. The
+ * renderer turns sprites to the viewer, the quads
+ * face +Z. The "frames" animation shows one node
+ * after the other at 10 fps by scaling the others
+ * to zero. The frame pics are passed as PNG, a
+ * frame without pic is exported untextured.
+ */
+func SP2ToGLB(data []byte, pics [][]byte) ([]byte, error) {
+	spr, err := loadSP2(data)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &gltfBuilder{}
+	b.doc.Asset = gltfAsset{"2.0", "quake2srv"}
+	b.doc.Scenes = []gltfScene{{}}
+
+	/* two triangles, counter clockwise seen from +Z */
+	indices := []uint32{0, 1, 2, 0, 2, 3}
+	texcoords := []float32{0, 1, 1, 1, 1, 0, 0, 0}
+	normals := []float32{0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 1}
+
+	/* frames often share a pic */
+	materials := make(map[string]int)
+
+	for i := range spr.Frames {
+		f := &spr.Frames[i]
+
+		left := float32(-f.Origin_x)
+		right := float32(f.Width - f.Origin_x)
+		down := float32(-f.Origin_y)
+		up := float32(f.Height - f.Origin_y)
+		positions := []float32{
+			left, down, 0,
+			right, down, 0,
+			right, up, 0,
+			left, up, 0,
+		}
+
+		prim := gltfPrimitive{}
+		prim.Attributes = map[string]int{
+			"POSITION":   b.addFloats(positions, "VEC3", true),
+			"NORMAL":     b.addFloats(normals, "VEC3", false),
+			"TEXCOORD_0": b.addFloats(texcoords, "VEC2", false),
+		}
+		prim.Indices = b.addIndices(indices, 4)
+
+		if (i < len(pics)) && (pics[i] != nil) {
+			m, ok := materials[f.Name]
+			if !ok {
+				m = b.addMaterial(f.Name, pics[i])
+				materials[f.Name] = m
+			}
+			prim.Material = &m
+		}
+
+		b.doc.Meshes = append(b.doc.Meshes, gltfMesh{Name: f.Name, Primitives: []gltfPrimitive{prim}})
+
+		node := gltfNode{Name: fmt.Sprintf("frame%v", i), Mesh: len(b.doc.Meshes) - 1}
+		if i > 0 {
+			node.Scale = []float32{0, 0, 0}
+		}
+		b.doc.Nodes = append(b.doc.Nodes, node)
+		b.doc.Scenes[0].Nodes = append(b.doc.Scenes[0].Nodes, len(b.doc.Nodes)-1)
+	}
+
+	if len(spr.Frames) > 1 {
+		times := make([]float32, len(spr.Frames))
+		for i := range times {
+			times[i] = float32(i) * 0.1
+		}
+		input := b.addFloats(times, "SCALAR", true)
+
+		anim := gltfAnimation{}
+		anim.Name = "frames"
+		for n := range spr.Frames {
+			scales := make([]float32, 0, len(spr.Frames)*3)
+			for i := range spr.Frames {
+				s := float32(0)
+				if i == n {
+					s = 1
+				}
+				scales = append(scales, s, s, s)
+			}
+
+			anim.Samplers = append(anim.Samplers, gltfAnimationSampler{
+				Input:         input,
+				Output:        b.addFloats(scales, "VEC3", false),
+				Interpolation: "STEP",
+			})
+			anim.Channels = append(anim.Channels, gltfAnimationChannel{
+				len(anim.Samplers) - 1, gltfAnimationChannelTarget{n, "scale"}})
+		}
+		b.doc.Animations = []gltfAnimation{anim}
+	}
+
+	return b.glb()
+}
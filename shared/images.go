@@ -0,0 +1,147 @@
+/*
+ * Copyright (C) 1997-2001 Id Software, Inc.
+ *
+ * This program is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or (at
+ * your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful, but
+ * WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.
+ *
+ * See the GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 59 Temple Place - Suite 330, Boston, MA
+ * 02111-1307, USA.
+ *
+ * =======================================================================
+ *
+ * Decoding of the 8 bit paletted images, .pcx pics and skins and .wal
+ * textures. The renderer isn't part of the server, this is used to
+ * hand the images to web clients in a format they understand.
+ *
+ * =======================================================================
+ */
+package shared
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+/*
+ * Decodes an 8 bit PCX image. Returns the
+ * pixels and the palette stored at the
+ * end of the file.
+ */
+func LoadPCX(data []byte) (pix, palette []byte, width, height int, err error) {
+	if len(data) < Pcx_size+768 {
+		return nil, nil, 0, 0, fmt.Errorf("PCX file is too short")
+	}
+
+	pcx := Pcx(data)
+
+	if (pcx.Manufacturer != 0x0a) || (pcx.Version != 5) ||
+		(pcx.Encoding != 1) || (pcx.Bits_per_pixel != 8) ||
+		(pcx.Color_planes > 1) {
+		return nil, nil, 0, 0, fmt.Errorf("Bad pcx file")
+	}
+
+	width = int(pcx.Xmax) - int(pcx.Xmin) + 1
+	height = int(pcx.Ymax) - int(pcx.Ymin) + 1
+	if (width <= 0) || (height <= 0) || (width > 4096) || (height > 4096) {
+		return nil, nil, 0, 0, fmt.Errorf("Bad pcx file size %vx%v", width, height)
+	}
+
+	/* rows are padded to an even number of bytes */
+	linelen := int(pcx.Bytes_per_line)
+	if linelen < width {
+		linelen = width
+	}
+
+	pix = make([]byte, width*height)
+	raw := data[Pcx_size : len(data)-768]
+	r := 0
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < linelen; {
+			if r >= len(raw) {
+				return nil, nil, 0, 0, fmt.Errorf("PCX file was malformed")
+			}
+
+			dataByte := raw[r]
+			r++
+			runLength := 1
+
+			if (dataByte & 0xC0) == 0xC0 {
+				runLength = int(dataByte & 0x3F)
+				if r >= len(raw) {
+					return nil, nil, 0, 0, fmt.Errorf("PCX file was malformed")
+				}
+				dataByte = raw[r]
+				r++
+			}
+
+			for ; runLength > 0; runLength-- {
+				if x < width {
+					pix[y*width+x] = dataByte
+				}
+				x++
+			}
+		}
+	}
+
+	palette = data[len(data)-768:]
+	return pix, palette, width, height, nil
+}
+
+/*
+ * Returns the pixels of one mip level of
+ * a .wal texture, level 0 is full size.
+ */
+func LoadWAL(data []byte, miplevel int) (pix []byte, width, height int, err error) {
+	if len(data) < Miptex_size {
+		return nil, 0, 0, fmt.Errorf("WAL file is too short")
+	}
+
+	if (miplevel < 0) || (miplevel >= MIPLEVELS) {
+		return nil, 0, 0, fmt.Errorf("Bad mip level %v", miplevel)
+	}
+
+	mt := Miptex(data)
+
+	width = int(mt.Width >> miplevel)
+	height = int(mt.Height >> miplevel)
+	ofs := int(mt.Offsets[miplevel])
+
+	if (width <= 0) || (height <= 0) || (width > 4096) || (height > 4096) ||
+		(ofs < Miptex_size) || (ofs+width*height > len(data)) {
+		return nil, 0, 0, fmt.Errorf("WAL file %s was malformed", mt.Name)
+	}
+
+	return data[ofs : ofs+width*height], width, height, nil
+}
+
+/*
+ * Builds an image from 8 bit pixels and
+ * a 768 byte palette. Color 255 is
+ * transparent, as in the renderer.
+ */
+func PalettedImage(pix, palette []byte, width, height int) *image.Paletted {
+	pal := make(color.Palette, 256)
+	for i := range pal {
+		if i == 255 {
+			pal[i] = color.NRGBA{}
+		} else {
+			pal[i] = color.NRGBA{palette[i*3], palette[i*3+1], palette[i*3+2], 255}
+		}
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, width, height), pal)
+	copy(img.Pix, pix)
+	return img
+}
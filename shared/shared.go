@@ -1,6 +1,7 @@
 package shared
 
 import (
+	"log"
 	"math"
 	"math/rand"
 	"strconv"
@@ -10,6 +11,11 @@ import (
 const (
 	MAX_QPATH = 64 /* max length of a quake game pathname */
 
+	/* key / value info strings */
+	MAX_INFO_KEY    = 64
+	MAX_INFO_VALUE  = 64
+	MAX_INFO_STRING = 512
+
 	/* angle indexes */
 	PITCH = 0 /* up / down */
 	YAW   = 1 /* left / right */
@@ -1252,7 +1258,7 @@ func COM_Parse(data string, index int) (string, int) {
  */
 func Info_ValueForKey(s, key string) string {
 
-	split := strings.Split(s, "\\")
+	split := strings.Split(strings.TrimPrefix(s, "\\"), "\\")
 	index := 0
 	for index < len(split)-1 {
 		if split[index] == key {
@@ -1264,6 +1270,79 @@ func Info_ValueForKey(s, key string) string {
 	return ""
 }
 
+/*
+ * Returns the info string without
+ * the given key and it's value.
+ */
+func Info_RemoveKey(s, key string) string {
+
+	if strings.Contains(key, "\\") {
+		return s
+	}
+
+	split := strings.Split(strings.TrimPrefix(s, "\\"), "\\")
+	result := ""
+	for index := 0; index < len(split)-1; index += 2 {
+		if split[index] == key {
+			continue
+		}
+		result += "\\" + split[index] + "\\" + split[index+1]
+	}
+
+	return result
+}
+
+/*
+ * Some characters are illegal in info strings
+ * because they can mess up the server's parsing
+ */
+func Info_Validate(s string) bool {
+	return !strings.ContainsAny(s, "\";")
+}
+
+/*
+ * Sets the key to the value, or removes
+ * the key when the value is empty. The
+ * info string is returned unchanged if
+ * the pair is invalid or too long.
+ */
+func Info_SetValueForKey(s, key, value string) string {
+
+	if strings.Contains(key, "\\") || strings.Contains(value, "\\") {
+		log.Printf("Can't use keys or values with a \\\n")
+		return s
+	}
+
+	if strings.Contains(key, ";") {
+		log.Printf("Can't use keys or values with a semicolon\n")
+		return s
+	}
+
+	if strings.Contains(key, "\"") || strings.Contains(value, "\"") {
+		log.Printf("Can't use keys or values with a \"\n")
+		return s
+	}
+
+	if (len(key) > MAX_INFO_KEY-1) || (len(value) > MAX_INFO_VALUE-1) {
+		log.Printf("Keys and values must be < 64 characters.\n")
+		return s
+	}
+
+	s = Info_RemoveKey(s, key)
+
+	if len(value) == 0 {
+		return s
+	}
+
+	newi := "\\" + key + "\\" + value
+	if len(newi)+len(s) > MAX_INFO_STRING {
+		log.Printf("Info string length exceeded\n")
+		return s
+	}
+
+	return s + newi
+}
+
 /*
  * Generate a pseudorandom
  * integer >0.
@@ -1298,8 +1377,17 @@ type QCommon interface {
 	SetServer(QServer)
 
 	LoadFile(path string) ([]byte, error)
+	FS_ListFiles(pattern string) []string
+	FS_ListMaps() []string
+	FS_FileExists(path string) bool
+	FS_Gamedir() string
+	FS_FileFromProtectedPak(path string) bool
 
 	Com_Error(code int, format string, a ...interface{}) error
+	Com_Printf(format string, a ...interface{})
+	Com_BeginRedirect(buffersize int, flush func(string))
+	Com_EndRedirect()
+	Com_ConsoleLines() []string
 
 	Netchan_OutOfBandPrint(adr string, format string, a ...interface{}) error
 
@@ -1318,14 +1406,19 @@ type QCommon interface {
 	Cvar_VariableString(var_name string) string
 	Cvar_VariableInt(var_name string) int
 	Cvar_VariableBool(var_name string) bool
+	Cvar_VariablesWithFlags(flags int) []*CvarT
+	Cvar_GetLatchedVars()
 
 	Cmd_AddCommand(cmd_name string, function func([]string, interface{}) error, arg interface{})
 	Cbuf_AddText(text string)
+	Cbuf_Execute() error
+	Cmd_ExecuteString(text string) error
 
 	Pmove(pm *Pmove_t)
 
 	CMLoadMap(name string, clientload bool, checksum *uint32) (*Cmodel_t, error)
 	CMEntityString() string
+	CMTextures() []string
 	CMPointLeafnum(p []float32) int
 	CMLeafCluster(leafnum int) int
 	CMLeafArea(leafnum int) int
@@ -1336,6 +1429,8 @@ type QCommon interface {
 	CMClusterPHS(cluster int) []byte
 	CMBoxLeafnums(mins, maxs []float32, list []int, listsize int, topnode *int) int
 	CMSetAreaPortalState(portalnum int, open bool)
+	CMWritePortalState() []bool
+	CMReadPortalState(portals []bool)
 	CMAreasConnected(area1, area2 int) bool
 	CMHeadnodeVisible(nodenum int, visbits []byte) bool
 	CMBoxTrace(start, end, mins, maxs []float32, headnode, brushmask int) Trace_t
@@ -1350,4 +1445,5 @@ type QCommon interface {
 type QServer interface {
 	Init() error
 	Frame(usec int) error
+	Precache() []string
 }
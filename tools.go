@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"quake2srv/common"
+	"quake2srv/game"
+	"quake2srv/shared"
+	"sort"
+	"strings"
+)
+
+/*
+ * Command line tools, they are run instead
+ * of the server, e.g.
+ * quake2srv md2gltf models/monsters/soldier/tris.md2 soldier.glb
+ * quake2srv sp2gltf sprites/s_explod.sp2
+ * quake2srv bspinfo base1
+ * Files of a mod are given with the mod directory
+ * like for /qfile/, e.g. ctf/players/male/tris.md2
+ */
+func runTool(args []string) int {
+	switch args[0] {
+	case "md2gltf", "sp2gltf":
+		return toolMD2GLTF(args[1:])
+	case "bspinfo":
+		return toolBSPInfo(args[1:])
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown command %s\n", args[0])
+	return 2
+}
+
+func toolMD2GLTF(args []string) int {
+	if (len(args) < 1) || (len(args) > 2) {
+		fmt.Fprintf(os.Stderr, "USAGE: md2gltf <model or sprite> [output]\n")
+		return 2
+	}
+
+	fsys, name := gameFilesystem(args[0])
+
+	bfr, err := fsys.LoadFile(name)
+	if err != nil || bfr == nil {
+		fmt.Fprintf(os.Stderr, "Couldn't load %s\n", args[0])
+		return 1
+	}
+
+	glb, err := convertToGLB(fsys, bfr, path.Ext(name))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		return 1
+	}
+
+	out := strings.TrimSuffix(path.Base(name), path.Ext(name)) + ".glb"
+	if len(args) > 1 {
+		out = args[1]
+	}
+
+	if err := os.WriteFile(out, glb, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Wrote %s\n", out)
+	return 0
+}
+
+var bspLumps = []struct {
+	name string
+	size int /* size of an element, 1 for raw data */
+}{
+	{"entities", 1},
+	{"planes", shared.Dplane_size},
+	{"vertexes", shared.Dvertex_size},
+	{"visibility", 1},
+	{"nodes", shared.Dnode_size},
+	{"texinfo", shared.Texinfo_size},
+	{"faces", shared.Dface_size},
+	{"lighting", 1},
+	{"leafs", shared.Dleaf_size},
+	{"leaffaces", 2},
+	{"leafbrushes", 2},
+	{"edges", shared.Dedge_size},
+	{"surfedges", 4},
+	{"models", shared.Dmodel_size},
+	{"brushes", shared.Dbrush_size},
+	{"brushsides", shared.Dbrushside_size},
+	{"pop", 1},
+	{"areas", shared.Darea_size},
+	{"areaportals", shared.Dareaportal_size},
+}
+
+/* keys that name the targetname of other entities */
+var bspTargetKeys = []string{"target", "killtarget", "pathtarget", "combattarget", "deathtarget"}
+
+/*
+ * Splits the entity string of a map into the
+ * key / value pairs of the entities.
+ */
+func parseEntities(data string) ([]map[string]string, error) {
+	var ents []map[string]string
+	var token string
+
+	index := 0
+	for {
+		token, index = shared.COM_Parse(data, index)
+		if index < 0 {
+			break
+		}
+
+		if token != "{" {
+			return nil, fmt.Errorf("found %s when expecting {", token)
+		}
+
+		ent := make(map[string]string)
+		for {
+			var key, value string
+			key, index = shared.COM_Parse(data, index)
+			if index < 0 {
+				return nil, fmt.Errorf("EOF without closing brace")
+			}
+
+			if key == "}" {
+				break
+			}
+
+			value, index = shared.COM_Parse(data, index)
+			if index < 0 {
+				return nil, fmt.Errorf("EOF without closing brace")
+			}
+
+			if value == "}" {
+				return nil, fmt.Errorf("closing brace without data")
+			}
+
+			ent[key] = value
+		}
+
+		ents = append(ents, ent)
+	}
+
+	return ents, nil
+}
+
+/*
+ * Loads a map like the server does and checks
+ * its entities. Exits with 1 if there's a problem,
+ * so it can be used to check maps before they
+ * are uploaded.
+ */
+func toolBSPInfo(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "USAGE: bspinfo <map>\n")
+		return 2
+	}
+
+	fsys, name := gameFilesystem(args[0])
+	if !strings.HasSuffix(name, ".bsp") {
+		name = "maps/" + name + ".bsp"
+	}
+
+	bfr, err := fsys.LoadFile(name)
+	if err != nil || bfr == nil {
+		fmt.Fprintf(os.Stderr, "Couldn't load %s\n", name)
+		return 1
+	}
+
+	problems := 0
+	problem := func(format string, a ...interface{}) {
+		fmt.Printf("ERROR: "+format+"\n", a...)
+		problems++
+	}
+
+	if len(bfr) < shared.Dheader_size {
+		problem("%s is too short", name)
+		return 1
+	}
+
+	header := shared.DheaderCreate(bfr)
+	fmt.Printf("%s: version %v, %v bytes\n", name, header.Version, len(bfr))
+
+	fmt.Printf("Lumps:\n")
+	for i, l := range bspLumps {
+		lump := header.Lumps[i]
+		if (lump.Fileofs < 0) || (lump.Filelen < 0) || (int(lump.Fileofs)+int(lump.Filelen) > len(bfr)) {
+			problem("lump %s is outside of the file", l.name)
+			continue
+		}
+
+		if l.size == 1 {
+			fmt.Printf("  %-12s %9v bytes\n", l.name, lump.Filelen)
+		} else {
+			fmt.Printf("  %-12s %9v bytes %7v\n", l.name, lump.Filelen, int(lump.Filelen)/l.size)
+		}
+	}
+
+	if problems > 0 {
+		return 1
+	}
+
+	/* the collision model is all the server needs */
+	c := common.CreateQuekeCommon(fsys)
+	var checksum uint32
+	if _, err := c.CMLoadMap(name, false, &checksum); err != nil {
+		problem("%s can't be loaded", name)
+		return 1
+	}
+
+	ents, err := parseEntities(c.CMEntityString())
+	if err != nil {
+		problem("bad entity string: %v", err)
+		return 1
+	}
+
+	classes := make(map[string]int)
+	targetnames := make(map[string]bool)
+	targeted := make(map[string]bool)
+	for i, ent := range ents {
+		classname := ent["classname"]
+		classes[classname]++
+
+		if len(classname) == 0 {
+			problem("entity %v has no classname", i)
+		}
+
+		if tn, ok := ent["targetname"]; ok {
+			targetnames[tn] = true
+		}
+
+		for _, key := range bspTargetKeys {
+			if t, ok := ent[key]; ok {
+				targeted[t] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(classes))
+	for classname := range classes {
+		names = append(names, classname)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("%v entities:\n", len(ents))
+	for _, classname := range names {
+		fmt.Printf("  %5v %s\n", classes[classname], classname)
+	}
+
+	if (len(ents) == 0) || (ents[0]["classname"] != "worldspawn") {
+		problem("the first entity isn't worldspawn")
+	}
+
+	for _, classname := range names {
+		if len(classname) > 0 && !game.HasSpawnFunction(classname) {
+			problem("%v entities of unknown class %s", classes[classname], classname)
+		}
+	}
+
+	if classes["info_player_start"] == 0 {
+		problem("no info_player_start")
+	}
+
+	for i, ent := range ents {
+		for _, key := range bspTargetKeys {
+			if t, ok := ent[key]; ok && !targetnames[t] {
+				problem("%s %v has %s \"%s\", but nothing has that targetname",
+					ent["classname"], i, key, t)
+			}
+		}
+
+		/* spawn points are targeted by the
+		   changelevels of other maps */
+		if tn, ok := ent["targetname"]; ok && !targeted[tn] &&
+			!strings.HasPrefix(ent["classname"], "info_player_") {
+			problem("%s %v has targetname \"%s\", but nothing targets it",
+				ent["classname"], i, tn)
+		}
+	}
+
+	if problems > 0 {
+		fmt.Printf("%v problems found\n", problems)
+		return 1
+	}
+
+	fmt.Printf("No problems found\n")
+	return 0
+}